@@ -2,11 +2,10 @@ package cmds
 
 import (
 	"fmt"
-	"os"
 
-	"github.com/alphauslabs/blue-sdk-go/session"
 	"github.com/alphauslabs/bluectl/params"
-	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"github.com/alphauslabs/bluectl/pkg/env"
 	"github.com/spf13/cobra"
 )
 
@@ -15,51 +14,49 @@ func AccessTokenCmd() *cobra.Command {
 		beta     bool
 		username string
 		password string
+		refresh  bool
+		noCache  bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "token",
 		Short: "Get access token for Ripple/Wave[Pro] authentication",
-		Long:  `Get access token for Ripple/Wave[Pro] authentication. See global flags for more information on the default environment variables.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var s *session.Session
-			var o []session.Option
-			if username != "" || password != "" {
-				o = append(o, session.WithGrantType("password"))
-				o = append(o, session.WithUsername(username))
-				o = append(o, session.WithPassword(password))
+		Long: `Get access token for Ripple/Wave[Pro] authentication. See global flags for more information on the default environment variables.
+
+Access tokens are cached in ~/.cache/alphaus/ per profile and login URL, and reused until shortly
+before they expire. Use --refresh to force a new token, or --no-cache to bypass the cache.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if beta {
+				params.Env = env.NameNext
 			}
 
-			switch {
-			case beta:
-				if params.AuthUrl == "" {
-					params.AuthUrl = session.LoginUrlRippleNext
-				}
-			default:
-				if params.AuthUrl == "" {
-					params.AuthUrl = session.LoginUrlRipple
-				}
+			s, err := auth.Default()
+			if err != nil {
+				return err
 			}
 
-			o = append(o, session.WithLoginUrl(params.AuthUrl))
-			o = append(o, session.WithClientId(params.ClientId))
-			o = append(o, session.WithClientSecret(params.ClientSecret))
-			s = session.New(o...)
+			s.Username = username
+			s.Password = password
+			s.Refresh = refresh
+			s.NoCache = s.NoCache || noCache
 
 			// Get actual access token.
-			token, err := s.AccessToken()
+			token, err := s.Token()
 			if err != nil {
-				logger.Error(err)
-				os.Exit(1)
+				return err
 			}
 
 			fmt.Print(token)
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
 	cmd.Flags().BoolVar(&beta, "beta", beta, "if true, access beta version (next)")
+	cmd.Flags().MarkDeprecated("beta", "use --env next instead")
 	cmd.Flags().StringVar(&username, "username", username, "if provided, 'password' grant type is implied")
 	cmd.Flags().StringVar(&password, "password", password, "if provided, 'password' grant type is implied")
+	cmd.Flags().BoolVar(&refresh, "refresh", refresh, "if true, get a new token and update the cache")
+	cmd.Flags().BoolVar(&noCache, "no-cache", noCache, "if true, don't read or write the token cache")
 	return cmd
 }
@@ -0,0 +1,162 @@
+package cmds
+
+import (
+	"fmt"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/config"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+func AliasSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <name> <command...>",
+		Short: "Create or update an alias",
+		Long: `Create or update an alias. <command> is a bluectl command line without the leading 'bluectl',
+either as a single quoted argument, or as separate arguments. $1, $2, etc. are replaced by the
+arguments of the alias; other arguments are appended. Flags after <name> are part of the command.
+
+For example:
+
+  $ bluectl alias set usage-by-acct 'cost aws usage get --id $1 --raw-input '\''{"awsOptions":{"groupByColumns":"account"}}'\'
+  $ bluectl usage-by-acct 123456789012 --start 20260801`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			for _, c := range cmd.Root().Commands() {
+				if c.Name() == name || c.HasAlias(name) {
+					return cmderr.Usage(fmt.Errorf("[%v] is a built-in command", name))
+				}
+			}
+
+			switch name {
+			case "help", "completion":
+				return cmderr.Usage(fmt.Errorf("[%v] is a built-in command", name))
+			}
+
+			command := args[1]
+			if len(args) > 2 {
+				command = config.Quote(args[1:])
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			err = cfg.SetAlias(name, command)
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("alias [%v] set to: %v", name, command)
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().SetInterspersed(false)
+	return cmd
+}
+
+func AliasListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List aliases",
+		Long:  `List aliases.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			w, err := output.New(output.Input{
+				Headers: []string{"NAME", "COMMAND"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for _, name := range cfg.Aliases() {
+				v, _ := cfg.Alias(name)
+				err = w.Append([]string{name, v})
+				if err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func AliasDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm <name> [name...]",
+		Short: "Remove aliases",
+		Long:  `Remove one or more aliases.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			for _, name := range args {
+				err = cfg.DeleteAlias(name)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			for _, name := range args {
+				logger.Infof("alias [%v] removed", name)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func AliasCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alias",
+		Short: "Manage command aliases in ~/.config/alphaus/config.toml",
+		Long: `Manage command aliases, stored in the [` + config.KeyAliases + `] table of ~/.config/alphaus/config.toml.
+'bluectl <alias> [args...]' runs the alias' command line, with $1, $2, etc. replaced by [args...].
+Built-in commands can't be aliased.`,
+		PersistentPreRun: noProfilePreRun,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Info("see -h for more information")
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.AddCommand(
+		AliasSetCmd(),
+		AliasListCmd(),
+		AliasDeleteCmd(),
+	)
+
+	return cmd
+}
@@ -0,0 +1,332 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/grpcconn"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// apiServices returns the Blue API services linked in our binary.
+func apiServices() []protoreflect.ServiceDescriptor {
+	var svcs []protoreflect.ServiceDescriptor
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if !strings.HasPrefix(string(fd.Package()), "blueapi.") {
+			return true
+		}
+
+		for i := 0; i < fd.Services().Len(); i++ {
+			svcs = append(svcs, fd.Services().Get(i))
+		}
+
+		return true
+	})
+
+	sort.Slice(svcs, func(i, j int) bool { return svcs[i].FullName() < svcs[j].FullName() })
+	return svcs
+}
+
+// apiName returns the short name of a service, without the blueapi. prefix.
+func apiName(sd protoreflect.ServiceDescriptor) string {
+	return strings.TrimPrefix(string(sd.FullName()), "blueapi.")
+}
+
+// findService returns the service named name, which can be its full name or
+// any dot-separated suffix of it (i.e. Cost, cost.v1.Cost), ignoring case.
+func findService(name string) (protoreflect.ServiceDescriptor, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	var found []protoreflect.ServiceDescriptor
+	for _, sd := range apiServices() {
+		full := strings.ToLower(string(sd.FullName()))
+		if full == name || strings.HasSuffix(full, "."+name) {
+			found = append(found, sd)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("service %q not found, see 'bluectl api' for the list", name)
+	case 1:
+		return found[0], nil
+	default:
+		var names []string
+		for _, sd := range found {
+			names = append(names, apiName(sd))
+		}
+
+		return nil, fmt.Errorf("service %q is ambiguous: %v", name, strings.Join(names, ", "))
+	}
+}
+
+// findMethod returns the method for <service>/<Method>.
+func findMethod(s string) (protoreflect.MethodDescriptor, error) {
+	i := strings.LastIndex(s, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid method %q, expected <service>/<Method>", s)
+	}
+
+	sd, err := findService(s[:i])
+	if err != nil {
+		return nil, err
+	}
+
+	for j := 0; j < sd.Methods().Len(); j++ {
+		md := sd.Methods().Get(j)
+		if strings.EqualFold(string(md.Name()), s[i+1:]) {
+			return md, nil
+		}
+	}
+
+	return nil, fmt.Errorf("method %q not found in %v, see 'bluectl api %v' for the list",
+		s[i+1:], apiName(sd), apiName(sd))
+}
+
+// newMessage returns a new message of type md, preferably the generated one.
+func newMessage(md protoreflect.MessageDescriptor) proto.Message {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName())
+	if err != nil {
+		return dynamicpb.NewMessage(md)
+	}
+
+	return mt.New().Interface()
+}
+
+// apiRow returns the top-level fields of m, for table and csv outputs.
+// Non-string values are in JSON.
+func apiRow(m proto.Message, keys []string) []string {
+	b, _ := output.Marshal(m)
+	var fields map[string]json.RawMessage
+	json.Unmarshal(b, &fields)
+	row := make([]string, len(keys))
+	for i, k := range keys {
+		v := fields[k]
+		if err := json.Unmarshal(v, &row[i]); err != nil {
+			row[i] = string(v)
+		}
+	}
+
+	return row
+}
+
+func ApiCmd() *cobra.Command {
+	var (
+		data string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "api [<service>[/<Method>]]",
+		Short: "Call any API method",
+		Long: `Call any Blue API method linked in bluectl, including the ones that don't have a command yet.
+<service> can be the full service name or any suffix of it, i.e. blueapi.cost.v1.Cost, cost.v1.Cost,
+or Cost. The request is set by --data, in the same format as --raw-input; the response is printed in
+JSON by default, or in the format set by --outfmt. Server-streaming methods print one item per
+message. Without <Method>, list the methods of <service>; without arguments, list the services.
+For example:
+
+  $ bluectl api Cost
+  $ bluectl api Cost/ListCalculationsSchedules --data '{"vendor":"aws"}'
+  $ bluectl api cost.v1.Cost/ReadCosts --data @req.yaml --outfmt jsonl`,
+		Args: cobra.MaximumNArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			var names []string
+			for _, sd := range apiServices() {
+				for i := 0; i < sd.Methods().Len(); i++ {
+					names = append(names, apiName(sd)+"/"+string(sd.Methods().Get(i).Name()))
+				}
+			}
+
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case len(args) == 0:
+				w, err := output.New(output.Input{
+					Headers: []string{"SERVICE", "METHODS"},
+				})
+
+				if err != nil {
+					return err
+				}
+
+				defer w.Close()
+				for _, sd := range apiServices() {
+					err = w.Append([]string{apiName(sd), fmt.Sprintf("%v", sd.Methods().Len())})
+					if err != nil {
+						return err
+					}
+				}
+
+				return w.Close()
+			case !strings.Contains(args[0], "/"):
+				sd, err := findService(args[0])
+				if err != nil {
+					return cmderr.Usage(err)
+				}
+
+				w, err := output.New(output.Input{
+					Headers: []string{"METHOD", "REQUEST", "RESPONSE", "STREAMING"},
+				})
+
+				if err != nil {
+					return err
+				}
+
+				defer w.Close()
+				for i := 0; i < sd.Methods().Len(); i++ {
+					md := sd.Methods().Get(i)
+					var streaming string
+					switch {
+					case md.IsStreamingClient() && md.IsStreamingServer():
+						streaming = "bidi"
+					case md.IsStreamingClient():
+						streaming = "client"
+					case md.IsStreamingServer():
+						streaming = "server"
+					}
+
+					err = w.Append([]string{
+						apiName(sd) + "/" + string(md.Name()),
+						string(md.Input().FullName()),
+						string(md.Output().FullName()),
+						streaming,
+					})
+
+					if err != nil {
+						return err
+					}
+				}
+
+				return w.Close()
+			}
+
+			md, err := findMethod(args[0])
+			if err != nil {
+				return cmderr.Usage(err)
+			}
+
+			if md.IsStreamingClient() {
+				return cmderr.Usage(fmt.Errorf("%v: client-streaming methods are not supported", args[0]))
+			}
+
+			in := newMessage(md.Input())
+			if data != "" {
+				b, err := rawinput.Read(data, params.RawInputVars)
+				if err != nil {
+					return cmderr.Usage(fmt.Errorf("invalid --data: %w", err))
+				}
+
+				err = protojson.Unmarshal(b, in)
+				if err != nil {
+					return cmderr.Usage(fmt.Errorf("invalid --data: %w", err))
+				}
+			}
+
+			sd := md.Parent().(protoreflect.ServiceDescriptor)
+			method := fmt.Sprintf("/%v/%v", sd.FullName(), md.Name())
+			if params.OutFmt == "" && params.OutFile == "" {
+				params.OutFmt = output.FormatJson
+				if params.ErrorFormat == "" {
+					params.ErrorFormat = cmderr.FormatText // only json if asked
+				}
+			}
+
+			var keys []string
+			for i := 0; i < md.Output().Fields().Len(); i++ {
+				keys = append(keys, md.Output().Fields().Get(i).JSONName())
+			}
+
+			ctx := cmd.Context()
+			con, err := grpcconn.GetConnection(ctx, grpcconn.TargetService(string(sd.ParentFile().Package())))
+			if err != nil {
+				return err
+			}
+
+			defer con.Close()
+			if !md.IsStreamingServer() {
+				out := newMessage(md.Output())
+				err = con.Invoke(ctx, method, in, out)
+				if err != nil {
+					return err
+				}
+
+				if len(keys) == 0 {
+					return nil // i.e. google.protobuf.Empty
+				}
+
+				w, err := output.New(output.Input{Keys: keys, Single: true})
+				if err != nil {
+					return err
+				}
+
+				defer w.Close()
+				err = w.Append(apiRow(out, keys), out)
+				if err != nil {
+					return err
+				}
+
+				return w.Close()
+			}
+
+			stream, err := con.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method)
+			if err != nil {
+				return err
+			}
+
+			err = stream.SendMsg(in)
+			if err != nil {
+				return err
+			}
+
+			err = stream.CloseSend()
+			if err != nil {
+				return err
+			}
+
+			w, err := output.New(output.Input{Keys: keys})
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for {
+				out := newMessage(md.Output())
+				err := stream.RecvMsg(out)
+				if err == io.EOF {
+					return w.Close()
+				}
+
+				if err != nil {
+					return err
+				}
+
+				err = w.Append(apiRow(out, keys), out)
+				if err != nil {
+					return err
+				}
+			}
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringVar(&data, "data", data, "request in JSON or YAML, @file, or - for stdin; same as --raw-input")
+	cmd.Flags().StringArrayVar(&params.RawInputVars, "var", nil, "key=value: template variable for --data, i.e. {{.key}}, repeatable; the input is a template only if set, where {{\"{{\"}} is a literal {{")
+	return cmd
+}
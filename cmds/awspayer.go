@@ -1,23 +1,20 @@
 package cmds
 
 import (
-	"context"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
 	protosinternal "github.com/alphauslabs/blue-internal-go/protos"
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/complete"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
 	"github.com/alphauslabs/bluectl/pkg/ops"
-	"github.com/olekukonko/tablewriter"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
 	"github.com/spf13/cobra"
 )
 
@@ -26,30 +23,16 @@ func ListPayersCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List registered payer accounts",
 		Long:  `List registered payer accounts.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -58,90 +41,35 @@ func ListPayersCmd() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			hdrs := []string{"ID", "NAME"}
+			w, err := output.New(output.Input{
+				Headers: []string{"ID", "NAME"},
+			})
 
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
+			if err != nil {
+				return err
+			}
 
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
-
-					wf.Write(hdrs)
-					for {
-						v, err := stream.Recv()
-						if err == io.EOF {
-							break
-						}
-
-						if err != nil {
-							fnerr(err)
-							return
-						}
-
-						row := []string{v.Id, v.Name}
-						logger.Infof("%v --> %v", row, params.OutFile)
-						wf.Write(row)
-					}
+			defer w.Close()
+			for {
+				v, err := stream.Recv()
+				if err == io.EOF {
+					break
 				}
-			case params.OutFmt == "json":
-				for {
-					v, err := stream.Recv()
-					if err == io.EOF {
-						break
-					}
-
-					if err != nil {
-						fnerr(err)
-						return
-					}
 
-					b, _ := json.Marshal(v)
-					logger.Info(string(b))
+				if err != nil {
+					return err
 				}
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader(hdrs)
-
-				for {
-					v, err := stream.Recv()
-					if err == io.EOF {
-						break
-					}
-
-					if err != nil {
-						fnerr(err)
-						return
-					}
 
-					table.Append([]string{v.Id, v.Name})
+				err = w.Append([]string{v.Id, v.Name}, v)
+				if err != nil {
+					return err
 				}
-
-				table.Render()
 			}
+
+			return w.Close()
 		},
 	}
 
@@ -154,35 +82,20 @@ func GetPayerCmd() *cobra.Command {
 		Use:   "get <id>",
 		Short: "Query a registered payer account",
 		Long:  `Query a registered payer account.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("id is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("id is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -192,62 +105,28 @@ func GetPayerCmd() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			hdrs := []string{"ID", "NAME", "METADATA"}
-
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
+			var md []string
+			for _, v := range resp.Metadata {
+				md = append(md, fmt.Sprintf("%v: %v", v.Key, v.Value))
+			}
 
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
+			err = output.Print(output.Input{
+				Headers: []string{"ID", "NAME", "METADATA"},
+			}, []string{resp.Id, resp.Name, strings.Join(md, "\n")}, resp)
 
-					wf.Write(hdrs)
-					for _, v := range resp.Metadata {
-						m := fmt.Sprintf("%v: %v", v.Key, v.Value)
-						wf.Write([]string{resp.Id, resp.Name, m})
-					}
-				}
-			case params.OutFmt == "json":
-				b, _ := json.Marshal(resp)
-				logger.Info(string(b))
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader(hdrs)
-
-				for _, v := range resp.Metadata {
-					m := fmt.Sprintf("%v: %v", v.Key, v.Value)
-					table.Append([]string{resp.Id, resp.Name, m})
-				}
-
-				table.Render()
+			if err != nil {
+				return err
 			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.Payers)
 	return cmd
 }
 
@@ -261,81 +140,27 @@ func CurImportHistoryCmd() *cobra.Command {
 		Use:   "get-curhistory <id>",
 		Short: "Query an AWS management account's CUR import history",
 		Long:  `Query an AWS management account's CUR import history.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
-			hdrs := []string{"PAYER", "MONTH", "TIMESTAMP"}
 			var stream cost.Cost_GetPayerAccountImportHistoryClient
 
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetAutoFormatHeaders(false)
-			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-			table.SetAlignment(tablewriter.ALIGN_LEFT)
-			table.SetColWidth(100)
-			table.SetBorder(false)
-			table.SetHeaderLine(false)
-			table.SetColumnSeparator("")
-			table.SetTablePadding("  ")
-			table.SetNoWhiteSpace(true)
-			table.SetHeader(hdrs)
-			var render bool
-
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write(hdrs)
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
-				}
-			}
-
 			switch {
 			case rawInput != "":
 				var in cost.GetPayerAccountImportHistoryRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				if in.Vendor == "" {
@@ -344,19 +169,16 @@ func CurImportHistoryCmd() *cobra.Command {
 
 				stream, err = client.GetPayerAccountImportHistory(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				if len(args) == 0 {
-					fnerr(fmt.Errorf("id is required"))
-					return
+					return cmderr.Usage(fmt.Errorf("id is required"))
 				}
 
 				mm, err := time.Parse("200601", month)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				in := cost.GetPayerAccountImportHistoryRequest{
@@ -367,28 +189,19 @@ func CurImportHistoryCmd() *cobra.Command {
 
 				stream, err = client.GetPayerAccountImportHistory(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			}
 
-			fnWrite := func(v *cost.GetPayerAccountImportHistoryResponse) {
-				switch {
-				case params.OutFile != "" && params.OutFmt == "csv":
-					for _, t := range v.Timestamps {
-						wf.Write([]string{v.Id, v.Month, t})
-					}
-				case params.OutFmt == "json":
-					b, _ := json.Marshal(v)
-					fmt.Println(string(b))
-				default:
-					render = true
-					for _, t := range v.Timestamps {
-						table.Append([]string{v.Id, v.Month, t})
-					}
-				}
+			w, err := output.New(output.Input{
+				Headers: []string{"PAYER", "MONTH", "TIMESTAMP"},
+			})
+
+			if err != nil {
+				return err
 			}
 
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -396,25 +209,24 @@ func CurImportHistoryCmd() *cobra.Command {
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				fnWrite(v)
-			}
-
-			if render {
-				table.Render()
+				for _, t := range v.Timestamps {
+					err = w.Append([]string{v.Id, v.Month, t}, v)
+					if err != nil {
+						return err
+					}
+				}
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
-			}
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_GetPayerAccountImportHistory")
+	cmd.ValidArgsFunction = complete.Args(complete.Payers)
+	rawinput.Flag(cmd, &rawInput, &cost.GetPayerAccountImportHistoryRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_GetPayerAccountImportHistory")
 	cmd.Flags().StringVar(&month, "month", time.Now().UTC().Format("200601"), "import month (UTC), fmt: yyyymm")
 	return cmd
 }
@@ -430,30 +242,16 @@ func ImportCursCmd() *cobra.Command {
 		Use:   "import-curs [id1[,id2,id...]]",
 		Short: "Trigger an ondemand import of all (or input) CUR files",
 		Long:  `Trigger an ondemand import of all (or input) CUR files.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -462,16 +260,14 @@ func ImportCursCmd() *cobra.Command {
 			switch {
 			case rawInput != "":
 				var in cost.ImportCurFilesRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				resp, err = client.ImportCurFiles(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				in := cost.ImportCurFilesRequest{}
@@ -481,68 +277,29 @@ func ImportCursCmd() *cobra.Command {
 
 				resp, err = client.ImportCurFiles(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			}
 
-			b, _ := json.Marshal(resp)
-			logger.Info(string(b))
+			err = output.Print(output.Input{
+				Headers: []string{"NAME", "DONE"},
+			}, []string{resp.Name, fmt.Sprintf("%v", resp.Done)}, resp)
+
+			if err != nil {
+				return err
+			}
 
 			if wait {
-				func() {
-					defer func(begin time.Time) {
-						logger.Info("duration:", time.Since(begin))
-					}(time.Now())
-
-					quit, cancel := context.WithCancel(context.Background())
-					done := make(chan struct{}, 1)
-
-					// Interrupt handler.
-					go func() {
-						sigch := make(chan os.Signal)
-						signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
-						<-sigch
-						cancel()
-					}()
-
-					go func() {
-						for {
-							q := context.WithValue(quit, struct{}{}, nil)
-							op, err := ops.WaitForOperation(q, ops.WaitForOperationInput{
-								Name: resp.Name,
-							})
-
-							if err != nil {
-								logger.Error(err)
-								done <- struct{}{}
-								return
-							}
-
-							if op != nil {
-								if op.Done {
-									logger.Infof("[%v] done", resp.Name)
-									done <- struct{}{}
-									return
-								}
-							}
-						}
-					}()
-
-					logger.Infof("wait for [%v], this could take some time...", resp.Name)
-
-					select {
-					case <-done:
-					case <-quit.Done():
-						logger.Info("interrupted")
-					}
-				}()
+				return ops.Wait(cmd.Context(), resp.Name)
 			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ImportCurFiles")
+	cmd.ValidArgsFunction = complete.List(complete.Payers)
+	rawinput.Flag(cmd, &rawInput, &cost.ImportCurFilesRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ImportCurFiles")
 	cmd.Flags().StringVar(&month, "month", time.Now().UTC().Format("200601"), "import month (UTC), fmt: yyyymm")
 	cmd.Flags().BoolVar(&wait, "wait", wait, "if true, wait for the operation to finish")
 	return cmd
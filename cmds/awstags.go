@@ -3,20 +3,50 @@ package cmds
 import (
 	"context"
 	"encoding/base64"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 
 	awstypes "github.com/alphauslabs/blue-sdk-go/api/aws"
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/alphauslabs/bluectl/pkg/retry"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
 )
 
+// costRow returns the common columns of tags and nontag-based costs.
+func costRow(v *awstypes.Cost) []string {
+	return []string{
+		v.GroupId,
+		v.Account,
+		v.Date,
+		v.ProductCode,
+		v.ServiceCode,
+		v.Region,
+		v.Zone,
+		v.UsageType,
+		v.InstanceType,
+		v.Operation,
+		v.InvoiceId,
+		v.Description,
+		v.ResourceId,
+		fmt.Sprintf("%.9f", v.Usage),
+		fmt.Sprintf("%.9f", v.Cost),
+		v.BaseCurrency,
+		fmt.Sprintf("%.f", v.ExchangeRate),
+		fmt.Sprintf("%.9f", v.TargetCost),
+		v.TargetCurrency,
+		fmt.Sprintf("%.9f", v.EffectiveCost),
+		fmt.Sprintf("%.9f", v.TargetEffectiveCost),
+		fmt.Sprintf("%.9f", v.AmortizedCost),
+		fmt.Sprintf("%.9f", v.TargetAmortizedCost),
+	}
+}
+
 func AwsGetTagsCmd() *cobra.Command {
 	var (
 		rawInput string
@@ -28,177 +58,104 @@ func AwsGetTagsCmd() *cobra.Command {
 		Long: `Read AWS tags-based costs. At the moment, we recommend you to use the --raw-input flag to take advantage
 of the API's full features described in https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadTagCosts.
 Note that this will invalidate all the other flags.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
+			var in cost.ReadTagCostsRequest
 
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
+			switch {
+			case rawInput != "":
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write([]string{
-						"groupId",
-						"account",
-						"date",
-						"productCode",
-						"serviceCode",
-						"region",
-						"zone",
-						"usageType",
-						"instanceType",
-						"operation",
-						"invoiceId",
-						"description",
-						"resourceId",
-						"usageAmount",
-						"cost",
-						"baseCurrency",
-						"exchangeRate",
-						"targetCost",
-						"targetCurrency",
-						"effectiveCost",
-						"targetEffectiveCost",
-						"amortizedCost",
-						"targetAmortizedCost",
-						"tagDetails",
-					})
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
+				if in.Vendor == "" {
+					in.Vendor = "aws"
 				}
+			default:
+				return cmderr.Usage(fmt.Errorf("not yet implemented, see --raw-input"))
 			}
 
-			fnWriteFile := func(v *awstypes.Cost) {
-				b, _ := json.Marshal(v)
-				fmt.Println(string(b))
-				if params.OutFile != "" {
-					td := v.TagId
-					if td != "" {
-						dec, err := base64.StdEncoding.DecodeString(td)
-						if err == nil {
-							td = string(dec)
-						}
-					}
+			w, err := output.New(output.Input{
+				Keys: []string{
+					"groupId",
+					"account",
+					"date",
+					"productCode",
+					"serviceCode",
+					"region",
+					"zone",
+					"usageType",
+					"instanceType",
+					"operation",
+					"invoiceId",
+					"description",
+					"resourceId",
+					"usageAmount",
+					"cost",
+					"baseCurrency",
+					"exchangeRate",
+					"targetCost",
+					"targetCurrency",
+					"effectiveCost",
+					"targetEffectiveCost",
+					"amortizedCost",
+					"targetAmortizedCost",
+					"tagDetails",
+				},
+				Progress: true,
+			})
 
-					switch params.OutFmt {
-					case "csv":
-						wf.Write([]string{
-							v.GroupId,
-							v.Account,
-							v.Date,
-							v.ProductCode,
-							v.ServiceCode,
-							v.Region,
-							v.Zone,
-							v.UsageType,
-							v.InstanceType,
-							v.Operation,
-							v.InvoiceId,
-							v.Description,
-							v.ResourceId,
-							fmt.Sprintf("%.9f", v.Usage),
-							fmt.Sprintf("%.9f", v.Cost),
-							v.BaseCurrency,
-							fmt.Sprintf("%.f", v.ExchangeRate),
-							fmt.Sprintf("%.9f", v.TargetCost),
-							v.TargetCurrency,
-							fmt.Sprintf("%.9f", v.EffectiveCost),
-							fmt.Sprintf("%.9f", v.TargetEffectiveCost),
-							fmt.Sprintf("%.9f", v.AmortizedCost),
-							fmt.Sprintf("%.9f", v.TargetAmortizedCost),
-							td,
-						})
-					case "json":
-						fmt.Fprintf(f, "%v\n", string(b))
-					}
-				}
+			if err != nil {
+				return err
 			}
 
-			var stream cost.Cost_ReadTagCostsClient
-
-			switch {
-			case rawInput != "":
-				var in cost.ReadTagCostsRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				if in.Vendor == "" {
-					in.Vendor = "aws"
-				}
+			defer w.Close()
+			stream := retry.Stream[*cost.CostItem]{
+				Open: func(ctx context.Context, from string) (retry.Receiver[*cost.CostItem], error) {
+					req := proto.Clone(&in).(*cost.ReadTagCostsRequest)
+					if from != "" {
+						req.StartTime = from
+					}
 
-				stream, err = client.ReadTagCosts(ctx, &in)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-			default:
-				logger.Error("not yet implemented, see --raw-input")
-				return
+					return client.ReadTagCosts(ctx, req)
+				},
+				Date: func(v *cost.CostItem) string { return v.Aws.GetDate() },
 			}
 
-			for {
-				v, err := stream.Recv()
-				if err == io.EOF {
-					break
+			err = stream.Do(ctx, func(v *cost.CostItem) error {
+				td := v.Aws.TagId
+				if td != "" {
+					dec, err := base64.StdEncoding.DecodeString(td)
+					if err == nil {
+						td = string(dec)
+					}
 				}
 
-				if err != nil {
-					fnerr(err)
-					return
-				}
+				return w.Append(append(costRow(v.Aws), td), v.Aws)
+			})
 
-				fnWriteFile(v.Aws)
+			if err != nil {
+				return err
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
-			}
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadTagCosts")
+	rawinput.Flag(cmd, &rawInput, &cost.ReadTagCostsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadTagCosts")
 	return cmd
 }
 
@@ -213,129 +170,27 @@ func AwsGetNonTagsCmd() *cobra.Command {
 		Long: `Read AWS nontag-based costs. At the moment, we recommend you to use the --raw-input flag to take advantage
 of the API's full features described in https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadNonTagCosts.
 Note that this will invalidate all the other flags.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
-
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write([]string{
-						"groupId",
-						"account",
-						"date",
-						"productCode",
-						"serviceCode",
-						"region",
-						"zone",
-						"usageType",
-						"instanceType",
-						"operation",
-						"invoiceId",
-						"description",
-						"resourceId",
-						"usageAmount",
-						"cost",
-						"baseCurrency",
-						"exchangeRate",
-						"targetCost",
-						"targetCurrency",
-						"effectiveCost",
-						"targetEffectiveCost",
-						"amortizedCost",
-						"targetAmortizedCost",
-					})
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
-				}
-			}
-
-			fnWriteFile := func(v *awstypes.Cost) {
-				b, _ := json.Marshal(v)
-				fmt.Println(string(b))
-				if params.OutFile != "" {
-					switch params.OutFmt {
-					case "csv":
-						wf.Write([]string{
-							v.GroupId,
-							v.Account,
-							v.Date,
-							v.ProductCode,
-							v.ServiceCode,
-							v.Region,
-							v.Zone,
-							v.UsageType,
-							v.InstanceType,
-							v.Operation,
-							v.InvoiceId,
-							v.Description,
-							v.ResourceId,
-							fmt.Sprintf("%.9f", v.Usage),
-							fmt.Sprintf("%.9f", v.Cost),
-							v.BaseCurrency,
-							fmt.Sprintf("%.f", v.ExchangeRate),
-							fmt.Sprintf("%.9f", v.TargetCost),
-							v.TargetCurrency,
-							fmt.Sprintf("%.9f", v.EffectiveCost),
-							fmt.Sprintf("%.9f", v.TargetEffectiveCost),
-							fmt.Sprintf("%.9f", v.AmortizedCost),
-							fmt.Sprintf("%.9f", v.TargetAmortizedCost),
-						})
-					case "json":
-						fmt.Fprintf(f, "%v\n", string(b))
-					}
-				}
-			}
-
 			var stream cost.Cost_ReadNonTagCostsClient
 
 			switch {
 			case rawInput != "":
 				var in cost.ReadNonTagCostsRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				if in.Vendor == "" {
@@ -344,14 +199,46 @@ Note that this will invalidate all the other flags.`,
 
 				stream, err = client.ReadNonTagCosts(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
-				logger.Error("not yet implemented, see --raw-input")
-				return
+				return cmderr.Usage(fmt.Errorf("not yet implemented, see --raw-input"))
 			}
 
+			w, err := output.New(output.Input{
+				Keys: []string{
+					"groupId",
+					"account",
+					"date",
+					"productCode",
+					"serviceCode",
+					"region",
+					"zone",
+					"usageType",
+					"instanceType",
+					"operation",
+					"invoiceId",
+					"description",
+					"resourceId",
+					"usageAmount",
+					"cost",
+					"baseCurrency",
+					"exchangeRate",
+					"targetCost",
+					"targetCurrency",
+					"effectiveCost",
+					"targetEffectiveCost",
+					"amortizedCost",
+					"targetAmortizedCost",
+				},
+				Progress: true,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -359,21 +246,21 @@ Note that this will invalidate all the other flags.`,
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				fnWriteFile(v.Aws)
+				err = w.Append(costRow(v.Aws), v.Aws)
+				if err != nil {
+					return err
+				}
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
-			}
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadTagCosts")
+	rawinput.Flag(cmd, &rawInput, &cost.ReadNonTagCostsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadTagCosts")
 	return cmd
 }
 
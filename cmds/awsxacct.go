@@ -1,23 +1,40 @@
 package cmds
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 
 	"github.com/alphauslabs/blue-sdk-go/admin/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/complete"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
 	"github.com/alphauslabs/bluectl/pkg/ops"
+	"github.com/alphauslabs/bluectl/pkg/output"
 	"github.com/spf13/cobra"
 )
 
+var defaultCostAccessHeaders = []string{
+	"TARGET",
+	"ROLE_ARN",
+	"EXTERNAL_ID",
+	"STACK_REGION",
+	"STATUS",
+	"LAST_UPDATED",
+}
+
+func defaultCostAccessRow(v *admin.DefaultCostAccess) []string {
+	return []string{
+		v.Target,
+		v.RoleArn,
+		v.ExternalId,
+		v.StackRegion,
+		v.Status,
+		v.LastUpdated,
+	}
+}
+
 func CreateDefaultCostAccessInfo() *cobra.Command {
 	var (
 		silent bool
@@ -52,35 +69,20 @@ If you want to audit the template, it is publicly available from the link below:
 
   s3only:
   https://alphaus-cloudformation-templates.s3.ap-northeast-1.amazonaws.com/alphauscurexportbucket-v1.yml`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("account is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("account is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			var s3only bool
@@ -94,23 +96,21 @@ If you want to audit the template, it is publicly available from the link below:
 					req.Type = args[1]
 					s3only = true
 				default:
-					fnerr(fmt.Errorf("unknown type: %v", args[1]))
-					return
+					return cmderr.Usage(fmt.Errorf("unknown type: %v", args[1]))
 				}
 			}
 
 			defer client.Close()
 			resp, err := client.GetDefaultCostAccessTemplateUrl(ctx, &req)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			fmt.Println("Open the link below in your browser and deploy:")
 			fmt.Println(resp.LaunchUrl)
 			if s3only {
 				fmt.Println("\nTo use the deployed bucket, rerun this command with the default type (empty) then select the 'USE_EXISTING' parameter in your CloudFormation console.")
-				return
+				return nil
 			}
 
 			var rep string
@@ -121,7 +121,7 @@ If you want to audit the template, it is publicly available from the link below:
 
 			switch strings.ToLower(rep) {
 			case "n":
-				return
+				return nil
 			case "":
 				fallthrough
 			case "y":
@@ -131,16 +131,20 @@ If you want to audit the template, it is publicly available from the link below:
 				})
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				b, _ := json.Marshal(resp)
-				fmt.Println(string(b))
+				err = output.Print(output.Input{Headers: defaultCostAccessHeaders},
+					defaultCostAccessRow(resp), resp)
+
+				if err != nil {
+					return err
+				}
 			default:
-				fnerr(fmt.Errorf("unknown reply"))
-				return
+				return fmt.Errorf("unknown reply")
 			}
+
+			return nil
 		},
 	}
 
@@ -154,39 +158,30 @@ func ListDefaultCostAccessInfo() *cobra.Command {
 		Use:   "list",
 		Short: "List default cost access information",
 		Long:  `List default cost access information.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			stream, err := client.ListDefaultCostAccess(ctx, &admin.ListDefaultCostAccessRequest{})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
+			w, err := output.New(output.Input{Headers: defaultCostAccessHeaders})
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -194,13 +189,16 @@ func ListDefaultCostAccessInfo() *cobra.Command {
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				b, _ := json.Marshal(v)
-				logger.Info(string(b))
+				err = w.Append(defaultCostAccessRow(v), v)
+				if err != nil {
+					return err
+				}
 			}
+
+			return w.Close()
 		},
 	}
 
@@ -213,35 +211,20 @@ func GetDefaultCostAccessInfo() *cobra.Command {
 		Use:   "get <account>",
 		Short: "Get default cost access information",
 		Long:  `Get default cost access information.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("account is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("account is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -250,21 +233,22 @@ func GetDefaultCostAccessInfo() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				logger.Info("format not supported yet")
-			default:
-				b, _ := json.Marshal(resp)
-				logger.Info(string(b))
+			err = output.Print(output.Input{Headers: defaultCostAccessHeaders},
+				defaultCostAccessRow(resp), resp)
+
+			if err != nil {
+				return err
 			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.CrossAccts)
 	return cmd
 }
 
@@ -278,35 +262,20 @@ func UpdateDefaultCostAccessInfo() *cobra.Command {
 		Short: "Update default cost access",
 		Long: `Update default cost access. Recommended when the status is 'outdated', which means there is an
 update to the CloudFormation template.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("account is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("account is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -315,58 +284,21 @@ update to the CloudFormation template.`,
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Infof("operation=%v", resp.Name)
 
 			if wait {
-				quit, cancel := context.WithCancel(context.Background())
-				done := make(chan struct{}, 1)
-
-				// Interrupt handler.
-				go func() {
-					sigch := make(chan os.Signal)
-					signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
-					<-sigch
-					cancel()
-				}()
-
-				go func() {
-					for {
-						q := context.WithValue(quit, struct{}{}, nil)
-						op, err := ops.WaitForOperation(q, ops.WaitForOperationInput{
-							Name: resp.Name,
-						})
-
-						if err != nil {
-							logger.Error(err)
-							done <- struct{}{}
-							return
-						}
-
-						if op != nil {
-							if op.Done {
-								done <- struct{}{}
-								return
-							}
-						}
-					}
-				}()
-
-				logger.Infof("wait for %v, this could take some time...", resp.Name)
-
-				select {
-				case <-done:
-				case <-quit.Done():
-					logger.Info("interrupted")
-				}
+				return ops.Wait(cmd.Context(), resp.Name)
 			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.CrossAccts)
 	cmd.Flags().BoolVar(&wait, "wait", wait, "wait for the update to finish")
 	return cmd
 }
@@ -376,35 +308,20 @@ func DelDefaultCostAccessInfo() *cobra.Command {
 		Use:   "rm <account>",
 		Short: "Remove default cost access",
 		Long:  `Remove default cost access. This does not delete the CloudFormation stack.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("account is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("account is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -413,15 +330,16 @@ func DelDefaultCostAccessInfo() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Info("cross-account access removed")
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.CrossAccts)
 	return cmd
 }
 
@@ -2,17 +2,16 @@ package cmds
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
-	"io"
 	"math"
-	"os"
 	"time"
 
 	"github.com/alphauslabs/blue-sdk-go/billing/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/complete"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/retry"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
@@ -28,25 +27,12 @@ func BillingAwsDriftCmd() *cobra.Command {
 		Long: `Query differences, if any, between your AWS invoice and latest costs. If [billingInternalId] is empty,
 all billing groups that have diffs will be returned. If [yyyymm] is not provided, it will default to
 the previous month.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			month = time.Now().UTC().AddDate(0, -1, 0).Format("200601")
 			if len(args) >= 1 {
 				mm, err := time.Parse("200601", args[0])
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				} else {
 					month = mm.Format("200601")
 				}
@@ -57,91 +43,38 @@ the previous month.`,
 				comp = args[1]
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.BillingService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := billing.NewClient(ctx, &billing.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			stream, err := client.ListUsageCostsDrift(ctx, &billing.ListUsageCostsDriftRequest{
-				Vendor:            "aws",
-				BillingInternalId: comp,
-				Month:             month,
-			})
-
-			if err != nil {
-				fnerr(err)
-				return
-			}
-
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
-
-					wf.Write([]string{
-						"billingInternalId",
-						"billingGroupId",
-						"account",
-						"month",
-						"snapshot",
-						"current",
-						"diff",
-						"drift",
-					})
-
-					for {
-						v, err := stream.Recv()
-						if err == io.EOF {
-							break
-						}
-
-						if err != nil {
-							fnerr(err)
-							return
-						}
-
-						row := []string{
-							v.BillingInternalId,
-							v.BillingGroupId,
-							v.Account,
-							month,
-							fmt.Sprintf("%f", v.Snapshot),
-							fmt.Sprintf("%f", v.Current),
-							fmt.Sprintf("%f", v.Diff),
-						}
-
-						logger.Infof("%v --> %v", row, params.OutFile)
-						wf.Write(row)
-					}
-				}
-			case params.OutFmt == "json":
-				logger.Info("format not supported")
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColumnAlignment([]int{
+			w, err := output.New(output.Input{
+				Headers: []string{
+					"INTERNAL_ID",
+					"BILLING_GROUP_ID",
+					"ACCOUNT",
+					"MONTH",
+					"SNAPSHOT",
+					"CURRENT",
+					"DIFF",
+				},
+				Keys: []string{
+					"billingInternalId",
+					"billingGroupId",
+					"account",
+					"month",
+					"snapshot",
+					"current",
+					"diff",
+				},
+				Align: []int{
 					tablewriter.ALIGN_LEFT,
 					tablewriter.ALIGN_LEFT,
 					tablewriter.ALIGN_LEFT,
@@ -149,79 +82,75 @@ the previous month.`,
 					tablewriter.ALIGN_RIGHT,
 					tablewriter.ALIGN_RIGHT,
 					tablewriter.ALIGN_RIGHT,
-				})
+				},
+				Progress: true,
+			})
 
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.Append([]string{
-					"INTERNAL_ID",
-					"BILLING_GROUP_ID",
-					"ACCOUNT",
-					"MONTH",
-					"SNAPSHOT",
-					"CURRENT",
-					"DIFF",
-				})
+			if err != nil {
+				return err
+			}
 
-				var totalSnap, totalCurr, totalDiff float64
-				vf := func(f float64) string {
-					if f == 0 {
-						return "%f"
-					} else {
-						return "%.9f"
-					}
+			defer w.Close()
+			var totalSnap, totalCurr, totalDiff float64
+			vf := func(f float64) string {
+				if f == 0 {
+					return "%f"
+				} else {
+					return "%.9f"
 				}
+			}
 
-				for {
-					v, err := stream.Recv()
-					if err == io.EOF {
-						break
-					}
-
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					row := []string{
-						v.BillingInternalId,
-						v.BillingGroupId,
-						v.Account,
-						month,
-						fmt.Sprintf(vf(v.Snapshot), v.Snapshot),
-						fmt.Sprintf(vf(v.Current), v.Current),
-						fmt.Sprintf(vf(v.Diff), math.Abs(v.Diff)),
-					}
+			// No date range to resume from; the whole month is re-issued on
+			// retries, minus the rows we already have.
+			stream := retry.Stream[*billing.UsageCostsDrift]{
+				Open: func(ctx context.Context, _ string) (retry.Receiver[*billing.UsageCostsDrift], error) {
+					return client.ListUsageCostsDrift(ctx, &billing.ListUsageCostsDriftRequest{
+						Vendor:            "aws",
+						BillingInternalId: comp,
+						Month:             month,
+					})
+				},
+			}
 
-					totalSnap += v.Snapshot
-					totalCurr += v.Current
-					totalDiff += math.Abs(v.Diff)
+			err = stream.Do(ctx, func(v *billing.UsageCostsDrift) error {
+				totalSnap += v.Snapshot
+				totalCurr += v.Current
+				totalDiff += math.Abs(v.Diff)
+				return w.Append([]string{
+					v.BillingInternalId,
+					v.BillingGroupId,
+					v.Account,
+					month,
+					fmt.Sprintf(vf(v.Snapshot), v.Snapshot),
+					fmt.Sprintf(vf(v.Current), v.Current),
+					fmt.Sprintf(vf(v.Diff), math.Abs(v.Diff)),
+				}, v)
+			})
 
-					fmt.Printf("\033[2K\rrecv:%v...", row)
-					table.Append(row)
-				}
+			if err != nil {
+				return err
+			}
 
-				fmt.Printf("\033[2K\r") // reset cursor
-				table.Append([]string{
-					"",
-					"",
-					"",
-					"TOTAL",
-					fmt.Sprintf(vf(totalSnap), totalSnap),
-					fmt.Sprintf(vf(totalCurr), totalCurr),
-					fmt.Sprintf(vf(totalDiff), totalDiff),
-				})
+			err = w.Footer([]string{
+				"",
+				"",
+				"",
+				"TOTAL",
+				fmt.Sprintf(vf(totalSnap), totalSnap),
+				fmt.Sprintf(vf(totalCurr), totalCurr),
+				fmt.Sprintf(vf(totalDiff), totalDiff),
+			})
 
-				table.Render()
+			if err != nil {
+				return err
 			}
+
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(nil, complete.BillingGroups)
 	return cmd
 }
 
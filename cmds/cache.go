@@ -0,0 +1,114 @@
+package cmds
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/cache"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func CacheListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List cached query results",
+		Long:  `List cached query results, newest first.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := cache.List()
+			if err != nil {
+				return err
+			}
+
+			w, err := output.New(output.Input{
+				Headers: []string{"KEY", "METHOD", "ROWS", "SIZE", "CREATED", "EXPIRES", "REQUEST"},
+				Keys:    []string{"key", "method", "rows", "size", "created", "expires", "request"},
+				Align: []int{
+					tablewriter.ALIGN_LEFT,
+					tablewriter.ALIGN_LEFT,
+					tablewriter.ALIGN_RIGHT,
+					tablewriter.ALIGN_RIGHT,
+				},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for _, e := range entries {
+				expires := e.Expires.Format(time.RFC3339)
+				if e.Expired() {
+					expires += " (expired)"
+				}
+
+				err = w.Append([]string{
+					e.Key[:12],
+					path.Base(e.Method),
+					fmt.Sprintf("%v", e.Rows),
+					fmt.Sprintf("%v", e.Size),
+					e.Created.Format(time.RFC3339),
+					expires,
+					string(e.Request),
+				}, e)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func CacheClearCmd() *cobra.Command {
+	var expired bool
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove cached query results",
+		Long:  `Remove all cached query results, or only the expired ones with --expired.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := cache.Clear(expired)
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("%v cached result(s) removed", n)
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().BoolVar(&expired, "expired", expired, "if true, only remove expired results")
+	return cmd
+}
+
+func CacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local cache of cost query results",
+		Long: `Manage the local cache of cost query results in ~/.cache/alphaus/query/.
+
+With --cache, the results of cost queries (usage, adjustments, tags, and attributes) that only cover
+closed months are saved locally, and reused until --cache-ttl (default 24h) expires. Queries that
+include the current month always go to the API.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Info("see -h for more information")
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.AddCommand(
+		CacheListCmd(),
+		CacheClearCmd(),
+	)
+
+	return cmd
+}
@@ -0,0 +1,343 @@
+package cmds
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/config"
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+func ConfigListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all profiles",
+		Long:  `List all profiles. The profile in use is marked with '*'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			current, _ := cfg.ProfileName(params.AuthProfile)
+			w, err := output.New(output.Input{
+				Headers: []string{"CURRENT", "NAME", "ENV", "AUTH_URL", "CLIENT_ID"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for _, name := range cfg.Profiles() {
+				p, _ := cfg.Profile(name)
+				var mark string
+				if name == current {
+					mark = "*"
+				}
+
+				err = w.Append([]string{mark, name, p["env"], p["auth-url"], p["client-id"]})
+				if err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func ConfigGetCmd() *cobra.Command {
+	var showSecrets bool
+	cmd := &cobra.Command{
+		Use:   "get [key]",
+		Short: "Show the settings of a profile",
+		Long: `Show the settings of the profile in use (or --profile). If <key> is provided, only its value
+is printed, which is useful for scripting. Valid keys: ` + strings.Join(config.Keys, ", ") + `.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			name, _ := cfg.ProfileName(params.AuthProfile)
+			p, ok := cfg.Profile(name)
+			if !ok {
+				return fmt.Errorf("profile [%v] not found in %v", name, cfg.Path())
+			}
+
+			if len(args) > 0 {
+				v, ok := p[args[0]]
+				if !ok {
+					return fmt.Errorf("[%v] is not set in profile [%v]", args[0], name)
+				}
+
+				fmt.Println(v)
+				return nil
+			}
+
+			var keys []string
+			for k := range p {
+				keys = append(keys, k)
+			}
+
+			sort.Strings(keys)
+			w, err := output.New(output.Input{Headers: []string{"KEY", "VALUE"}})
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for _, k := range keys {
+				v := p[k]
+				if k == "client-secret" && !showSecrets {
+					v = "********"
+				}
+
+				err = w.Append([]string{k, v})
+				if err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", showSecrets, "if true, show secret values as is")
+	return cmd
+}
+
+func ConfigSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <key> <value> [<key> <value>...]",
+		Short: "Set profile settings",
+		Long: `Set one or more settings of the profile in use (or --profile). The profile is created if it
+doesn't exist yet. Valid keys are:
+
+  client-id           your client id
+  client-secret       your client secret
+  client-secret-file  file that contains your client secret
+  credential-process  command that outputs {"clientId":"...","clientSecret":"..."}
+  auth-url            authentication URL
+  env                 environment: prod, next, custom
+  endpoint            gRPC endpoint (host:port), required for the custom env
+  rest-url            REST base URL, required for REST calls in the custom env
+  plaintext           default for --plaintext: true, false
+  insecure            default for --insecure: true, false
+  ca-cert             default for --ca-cert
+  outfmt              default output format: ` + strings.Join(output.Formats, ", ") + `
+  bare                default for --bare: true, false
+  timeout             default for --timeout: max duration of the command, i.e. 30s, 5m
+
+Only one of client-secret, client-secret-file, and credential-process can be set.
+
+For example, to setup a new profile:
+
+  $ bluectl --profile dev config set client-id xxx client-secret yyy env next`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 || len(args)%2 != 0 {
+				return fmt.Errorf("requires <key> <value> pairs")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			name, _ := cfg.ProfileName(params.AuthProfile)
+			for i := 0; i < len(args); i += 2 {
+				err = cfg.Set(name, args[i], args[i+1])
+				if err != nil {
+					return err
+				}
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("profile [%v] updated", name)
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func ConfigUnsetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unset <key> [key...]",
+		Short: "Remove profile settings",
+		Long:  `Remove one or more settings from the profile in use (or --profile).`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			name, _ := cfg.ProfileName(params.AuthProfile)
+			for _, k := range args {
+				err = cfg.Unset(name, k)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("profile [%v] updated", name)
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func ConfigUseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use <profile>",
+		Short: "Set the current profile",
+		Long: `Set the current profile, used when neither --profile nor $` + config.EnvProfile + ` is set.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Use(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("current profile set to [%v]", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func ConfigRenameCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rename <old> <new>",
+		Short: "Rename a profile",
+		Long:  `Rename a profile.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Rename(args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("profile [%v] renamed to [%v]", args[0], args[1])
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func ConfigDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <profile>",
+		Short: "Delete a profile",
+		Long:  `Delete a profile.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Delete(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Save()
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("profile [%v] deleted", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+// noProfilePreRun replaces the root command's PersistentPreRun, which loads
+// the profile, for commands that don't need one: config (the profile might
+// be the one we're trying to fix), alias, and schema.
+func noProfilePreRun(cmd *cobra.Command, args []string) {
+	cmderr.Running()
+	if params.CleanOut {
+		logger.SetPrefix(logger.PrefixNone)
+	}
+}
+
+func ConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage profiles in ~/.config/alphaus/config.toml",
+		Long: `Manage profiles in ~/.config/alphaus/config.toml. Subcommands operate on the profile in use,
+which is (in order) the value of --profile, $` + config.EnvProfile + `, current-profile, then [default].`,
+		PersistentPreRun: noProfilePreRun,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Info("see -h for more information")
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.AddCommand(
+		ConfigListCmd(),
+		ConfigGetCmd(),
+		ConfigSetCmd(),
+		ConfigUnsetCmd(),
+		ConfigUseCmd(),
+		ConfigRenameCmd(),
+		ConfigDeleteCmd(),
+	)
+
+	return cmd
+}
@@ -2,19 +2,18 @@ package adjustments
 
 import (
 	"context"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
-	"io"
-	"os"
 	"time"
 
-	awstypes "github.com/alphauslabs/blue-sdk-go/api/aws"
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/alphauslabs/bluectl/pkg/retry"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
 )
 
 func GetCmd() *cobra.Command {
@@ -32,121 +31,35 @@ func GetCmd() *cobra.Command {
 		Long: `Read AWS adjustment costs. At the moment, we recommend you to use the --raw-input flag to take advantage
 of the API's full features described in https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadAdjustments.
 Note that this will invalidate all the other flags.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
-
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write([]string{
-						"groupId",
-						"account",
-						"date",
-						"type",
-						"productCode",
-						"description",
-						"cost",
-						"baseCurrency",
-						"exchangeRate",
-						"targetCost",
-						"targetCurrency",
-					})
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
-				}
-			}
-
-			fnWriteFile := func(v *awstypes.Cost) {
-				b, _ := json.Marshal(v)
-				fmt.Println(string(b))
-				if params.OutFile != "" {
-					switch params.OutFmt {
-					case "csv":
-						wf.Write([]string{
-							v.GroupId,
-							v.Account,
-							v.Date,
-							v.Type,
-							v.ProductCode,
-							v.Description,
-							fmt.Sprintf("%.9f", v.Cost),
-							v.BaseCurrency,
-							fmt.Sprintf("%f", v.ExchangeRate),
-							fmt.Sprintf("%.9f", v.TargetCost),
-							v.TargetCurrency,
-						})
-					case "json":
-						fmt.Fprintf(f, "%v\n", string(b))
-					}
-				}
-			}
-
-			var stream cost.Cost_ReadAdjustmentsClient
+			var in cost.ReadAdjustmentsRequest
 
 			switch {
 			case rawInput != "":
-				var in cost.ReadAdjustmentsRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				if in.Vendor == "" {
 					in.Vendor = "aws"
 				}
-
-				stream, err = client.ReadAdjustments(ctx, &in)
-				if err != nil {
-					fnerr(err)
-					return
-				}
 			default:
 				if costtype != "all" {
 					if id == "" {
-						fnerr(fmt.Errorf("--id is required"))
-						return
+						return cmderr.Usage(fmt.Errorf("--id is required"))
 					}
 				}
 
@@ -154,20 +67,18 @@ Note that this will invalidate all the other flags.`,
 				if start != "" {
 					ts, err = time.Parse("20060102", start)
 					if err != nil {
-						fnerr(err)
-						return
+						return err
 					}
 				}
 
 				if end != "" {
 					te, err = time.Parse("20060102", end)
 					if err != nil {
-						fnerr(err)
-						return
+						return err
 					}
 				}
 
-				in := cost.ReadAdjustmentsRequest{
+				in = cost.ReadAdjustmentsRequest{
 					Vendor:    "aws",
 					StartTime: ts.Format("20060102"),
 					EndTime:   te.Format("20060102"),
@@ -179,39 +90,70 @@ Note that this will invalidate all the other flags.`,
 				case "billinggroup":
 					in.GroupId = id
 				default:
-					fnerr(fmt.Errorf("type unsupported: %v", costtype))
-					return
-				}
-
-				stream, err = client.ReadAdjustments(ctx, &in)
-				if err != nil {
-					fnerr(err)
-					return
+					return cmderr.Usage(fmt.Errorf("type unsupported: %v", costtype))
 				}
 			}
 
-			for {
-				v, err := stream.Recv()
-				if err == io.EOF {
-					break
-				}
+			w, err := output.New(output.Input{
+				Keys: []string{
+					"groupId",
+					"account",
+					"date",
+					"type",
+					"productCode",
+					"description",
+					"cost",
+					"baseCurrency",
+					"exchangeRate",
+					"targetCost",
+					"targetCurrency",
+				},
+				Progress: true,
+			})
 
-				if err != nil {
-					fnerr(err)
-					return
-				}
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			stream := retry.Stream[*cost.CostItem]{
+				Open: func(ctx context.Context, from string) (retry.Receiver[*cost.CostItem], error) {
+					req := proto.Clone(&in).(*cost.ReadAdjustmentsRequest)
+					if from != "" {
+						req.StartTime = from
+					}
 
-				fnWriteFile(v.Aws)
+					return client.ReadAdjustments(ctx, req)
+				},
+				Date: func(v *cost.CostItem) string { return v.Aws.GetDate() },
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
+			err = stream.Do(ctx, func(v *cost.CostItem) error {
+				return w.Append([]string{
+					v.Aws.GroupId,
+					v.Aws.Account,
+					v.Aws.Date,
+					v.Aws.Type,
+					v.Aws.ProductCode,
+					v.Aws.Description,
+					fmt.Sprintf("%.9f", v.Aws.Cost),
+					v.Aws.BaseCurrency,
+					fmt.Sprintf("%f", v.Aws.ExchangeRate),
+					fmt.Sprintf("%.9f", v.Aws.TargetCost),
+					v.Aws.TargetCurrency,
+				}, v.Aws)
+			})
+
+			if err != nil {
+				return err
 			}
+
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadAdjustments")
+	rawinput.Flag(cmd, &rawInput, &cost.ReadAdjustmentsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadAdjustments")
 	cmd.Flags().StringVar(&id, "id", id, "account id or billing group id, depending on --type, skipped if 'all'")
 	cmd.Flags().StringVar(&costtype, "type", "account", "type of cost to stream: all, account, billinggroup")
 	cmd.Flags().StringVar(&start, "start", time.Now().UTC().Format("200601")+"01", "yyyymmdd: start date to stream data; default: first day of the current month (UTC)")
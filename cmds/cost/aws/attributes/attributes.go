@@ -1,20 +1,16 @@
 package attributes
 
 import (
-	"context"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"sort"
 	"strings"
 
-	awstypes "github.com/alphauslabs/blue-sdk-go/api/aws"
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
-	"github.com/olekukonko/tablewriter"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
 	"github.com/spf13/cobra"
 )
 
@@ -30,113 +26,19 @@ func GetCmd() *cobra.Command {
 		Long: `Get AWS cost attributes. At the moment, we recommend you to use the --raw-input flag to take advantage
 of the API's full features described in https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadCostAttributes.
 Note that this will invalidate all the other flags.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
-
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write([]string{
-						"groupId",
-						"account",
-						"productCode",
-						"serviceCode",
-						"region",
-						"zone",
-						"usageType",
-						"instanceType",
-						"operation",
-						"invoiceId",
-						"description",
-						"resourceId",
-						"tags",
-						"costCategories",
-					})
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
-				}
-			}
-
-			fnWriteFile := func(v *awstypes.CostAttribute) {
-				b, _ := json.Marshal(v)
-				fmt.Println(string(b))
-				if params.OutFile != "" {
-					var tags, cc string
-					if v.Tags != nil {
-						b, _ := json.Marshal(v.Tags)
-						tags = string(b)
-					}
-
-					if v.CostCategories != nil {
-						b, _ := json.Marshal(v.CostCategories)
-						cc = string(b)
-					}
-
-					switch params.OutFmt {
-					case "csv":
-						wf.Write([]string{
-							v.GroupId,
-							v.Account,
-							v.ProductCode,
-							v.ServiceCode,
-							v.Region,
-							v.Zone,
-							v.UsageType,
-							v.InstanceType,
-							v.Operation,
-							v.InvoiceId,
-							v.Description,
-							v.ResourceId,
-							tags,
-							cc,
-						})
-					case "json":
-						fmt.Fprintf(f, "%v\n", string(b))
-					}
-				}
-			}
-
 			type colT struct {
 				name   string
 				title  string
@@ -166,10 +68,9 @@ Note that this will invalidate all the other flags.`,
 
 			switch {
 			case rawInput != "":
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				if in.Vendor == "" {
@@ -200,33 +101,33 @@ Note that this will invalidate all the other flags.`,
 
 				stream, err = client.ReadCostAttributes(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				logger.Info("please use --raw-input for now, sorry")
-				return
+				return nil
 			}
 
+			keys := []string{}
 			for _, v := range refCols {
 				if v.enable {
 					cols = append(cols, v.title)
+					keys = append(keys, v.name)
 				}
 			}
 
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetAutoFormatHeaders(false)
-			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-			table.SetAlignment(tablewriter.ALIGN_LEFT)
-			table.SetColWidth(colWidth)
-			table.SetBorder(false)
-			table.SetHeaderLine(false)
-			table.SetColumnSeparator("")
-			table.SetTablePadding("  ")
-			table.SetNoWhiteSpace(true)
-			table.SetHeader(cols)
-			var render bool
+			w, err := output.New(output.Input{
+				Headers:  cols,
+				Keys:     keys,
+				ColWidth: colWidth,
+				Progress: true,
+			})
+
+			if err != nil {
+				return err
+			}
 
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -234,64 +135,53 @@ Note that this will invalidate all the other flags.`,
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				switch {
-				case params.OutFile != "":
-					fnWriteFile(v.Aws)
-				default:
-					render = true
-					refCols[0].val = v.Aws.Account
-					refCols[1].val = v.Aws.ProductCode
-					refCols[2].val = v.Aws.ServiceCode
-					refCols[3].val = v.Aws.Region
-					refCols[4].val = v.Aws.Zone
-					refCols[5].val = v.Aws.UsageType
-					refCols[6].val = v.Aws.InstanceType
-					refCols[7].val = v.Aws.Operation
-					refCols[8].val = v.Aws.InvoiceId
-					refCols[9].val = v.Aws.Description
-					refCols[10].val = v.Aws.ResourceId
-					refCols[11].val = v.Aws.Tags
-					refCols[12].val = v.Aws.CostCategories
-					row := []string{}
-					for _, rc := range refCols {
-						if rc.enable {
-							if (rc.name == "tags" || rc.name == "costCategories") && rc.val != nil {
-								ms := []string{}
-								m := rc.val.(map[string]string)
-								for k, v := range m {
-									ms = append(ms, fmt.Sprintf("%v:%v", k, v))
-								}
-
-								jms := strings.Join(ms, ",")
-								row = append(row, fmt.Sprintf("%v", jms))
-							} else {
-								row = append(row, fmt.Sprintf("%v", rc.val))
+				refCols[0].val = v.Aws.Account
+				refCols[1].val = v.Aws.ProductCode
+				refCols[2].val = v.Aws.ServiceCode
+				refCols[3].val = v.Aws.Region
+				refCols[4].val = v.Aws.Zone
+				refCols[5].val = v.Aws.UsageType
+				refCols[6].val = v.Aws.InstanceType
+				refCols[7].val = v.Aws.Operation
+				refCols[8].val = v.Aws.InvoiceId
+				refCols[9].val = v.Aws.Description
+				refCols[10].val = v.Aws.ResourceId
+				refCols[11].val = v.Aws.Tags
+				refCols[12].val = v.Aws.CostCategories
+				row := []string{}
+				for _, rc := range refCols {
+					if rc.enable {
+						if (rc.name == "tags" || rc.name == "costCategories") && rc.val != nil {
+							ms := []string{}
+							m := rc.val.(map[string]string)
+							for k, v := range m {
+								ms = append(ms, fmt.Sprintf("%v:%v", k, v))
 							}
+
+							sort.Strings(ms)
+							jms := strings.Join(ms, ",")
+							row = append(row, fmt.Sprintf("%v", jms))
+						} else {
+							row = append(row, fmt.Sprintf("%v", rc.val))
 						}
 					}
-
-					fmt.Printf("\033[2K\rrecv:%v...", row)
-					table.Append(row)
 				}
-			}
 
-			if render {
-				fmt.Printf("\033[2K\r") // reset cursor
-				table.Render()
+				err = w.Append(row, v.Aws)
+				if err != nil {
+					return err
+				}
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
-			}
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadCostAttributes")
+	rawinput.Flag(cmd, &rawInput, &cost.ReadCostAttributesRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadCostAttributes")
 	cmd.Flags().IntVar(&colWidth, "col-width", 30, "set column width, applies to table-based outputs only")
 	return cmd
 }
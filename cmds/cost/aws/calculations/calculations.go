@@ -1,19 +1,13 @@
 package calculations
 
 import (
-	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
 	protosinternal "github.com/alphauslabs/blue-internal-go/protos"
-	"github.com/alphauslabs/blue-sdk-go/api"
 	"github.com/alphauslabs/blue-sdk-go/billing/v1"
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
 	"github.com/alphauslabs/bluectl/cmds/cost/aws/calculations/schedule"
@@ -21,11 +15,10 @@ import (
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
 	"github.com/alphauslabs/bluectl/pkg/ops"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
 	"github.com/fatih/color"
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -39,30 +32,16 @@ func RunCmd() *cobra.Command {
 		Use:   "run",
 		Short: "Trigger an ondemand AWS costs calculation",
 		Long:  `Trigger an ondemand AWS costs calculation.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -71,10 +50,9 @@ func RunCmd() *cobra.Command {
 			switch {
 			case rawInput != "":
 				var in cost.CalculateCostsRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				if in.Vendor == "" {
@@ -83,8 +61,7 @@ func RunCmd() *cobra.Command {
 
 				resp, err = client.CalculateCosts(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				resp, err = client.CalculateCosts(ctx, &cost.CalculateCostsRequest{
@@ -92,68 +69,28 @@ func RunCmd() *cobra.Command {
 				})
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			}
 
-			b, _ := json.Marshal(resp)
-			logger.Info(string(b))
-
-			if wait {
-				func() {
-					defer func(begin time.Time) {
-						logger.Info("duration:", time.Since(begin))
-					}(time.Now())
-
-					quit, cancel := context.WithCancel(context.Background())
-					done := make(chan struct{}, 1)
-
-					// Interrupt handler.
-					go func() {
-						sigch := make(chan os.Signal)
-						signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
-						<-sigch
-						cancel()
-					}()
-
-					go func() {
-						for {
-							q := context.WithValue(quit, struct{}{}, nil)
-							op, err := ops.WaitForOperation(q, ops.WaitForOperationInput{
-								Name: resp.Name,
-							})
-
-							if err != nil {
-								logger.Error(err)
-								done <- struct{}{}
-								return
-							}
+			err = output.Print(output.Input{
+				Headers: []string{"NAME", "DONE"},
+			}, []string{resp.Name, fmt.Sprintf("%v", resp.Done)}, resp)
 
-							if op != nil {
-								if op.Done {
-									logger.Infof("[%v] done", resp.Name)
-									done <- struct{}{}
-									return
-								}
-							}
-						}
-					}()
-
-					logger.Infof("wait for [%v], this could take some time...", resp.Name)
+			if err != nil {
+				return err
+			}
 
-					select {
-					case <-done:
-					case <-quit.Done():
-						logger.Info("interrupted")
-					}
-				}()
+			if wait {
+				return ops.Wait(cmd.Context(), resp.Name)
 			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_CalculateCosts")
+	rawinput.Flag(cmd, &rawInput, &cost.CalculateCostsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_CalculateCosts")
 	cmd.Flags().BoolVar(&wait, "wait", wait, "if true, wait for the operation to finish")
 	return cmd
 }
@@ -164,87 +101,29 @@ func ListRunningCmd() *cobra.Command {
 		Short: "List AWS accounts that are still processing",
 		Long: `List AWS accounts that are still processing. The format for [month] is yyyymm.
 If [month] is not provided, it defaults to the current UTC month.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			mm := time.Now().UTC().Format("200601")
 			if len(args) > 0 {
 				_, err := time.Parse("200601", args[0])
 				if err != nil {
-					fnerr(err)
-				} else {
-					mm = args[0]
+					return err
 				}
+
+				mm = args[0]
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
-
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write([]string{"month", "account", "date", "started"})
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
-				}
-			}
-
-			fnWrite := func(v *cost.ListCalculatorRunningAccountsResponse) {
-				b, _ := json.Marshal(v)
-				fmt.Println(string(b))
-				if params.OutFile != "" {
-					switch params.OutFmt {
-					case "csv":
-						wf.Write([]string{
-							v.Aws.Month,
-							v.Aws.Account,
-							v.Aws.Date,
-							v.Aws.Started,
-						})
-					case "json":
-						fmt.Fprintf(f, "%v\n", string(b))
-					}
-				}
-			}
-
 			stream, err := client.ListCalculatorRunningAccounts(ctx,
 				&cost.ListCalculatorRunningAccountsRequest{
 					Vendor: "aws",
@@ -253,23 +132,19 @@ If [month] is not provided, it defaults to the current UTC month.`,
 			)
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetAutoFormatHeaders(false)
-			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-			table.SetAlignment(tablewriter.ALIGN_LEFT)
-			table.SetColWidth(100)
-			table.SetBorder(false)
-			table.SetHeaderLine(false)
-			table.SetColumnSeparator("")
-			table.SetTablePadding("  ")
-			table.SetNoWhiteSpace(true)
-			table.SetHeader([]string{"MONTH", "ACCOUNT", "DATE", "STARTED"})
-			var render bool
+			w, err := output.New(output.Input{
+				Headers:  []string{"MONTH", "ACCOUNT", "DATE", "STARTED"},
+				Progress: true,
+			})
+
+			if err != nil {
+				return err
+			}
 
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -277,35 +152,22 @@ If [month] is not provided, it defaults to the current UTC month.`,
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				switch {
-				case params.OutFile != "":
-					fnWrite(v)
-				default:
-					render = true
-					row := []string{
-						v.Aws.Month,
-						v.Aws.Account,
-						v.Aws.Date,
-						v.Aws.Started,
-					}
+				err = w.Append([]string{
+					v.Aws.Month,
+					v.Aws.Account,
+					v.Aws.Date,
+					v.Aws.Started,
+				}, v)
 
-					fmt.Printf("\033[2K\rrecv:%v...", row)
-					table.Append(row)
+				if err != nil {
+					return err
 				}
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
-			}
-
-			if render {
-				fmt.Printf("\033[2K\r") // reset cursor
-				table.Render()
-			}
+			return w.Close()
 		},
 	}
 
@@ -332,81 +194,27 @@ func ListHistoryCmd() *cobra.Command {
 		Use:   "list-history",
 		Short: "Query AWS calculation history",
 		Long:  `Query AWS calculation history.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
-			var f *os.File
-			var wf *csv.Writer
-			hdrs := []string{"NAME", "MONTH", "GROUPS", "UPDATED", "CREATED", "STATUS", "DONE", "RESULT"}
 			var resp *cost.ListCalculationsHistoryResponse
 
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetAutoFormatHeaders(false)
-			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-			table.SetAlignment(tablewriter.ALIGN_LEFT)
-			table.SetColWidth(100)
-			table.SetBorder(false)
-			table.SetHeaderLine(false)
-			table.SetColumnSeparator("")
-			table.SetTablePadding("  ")
-			table.SetNoWhiteSpace(true)
-			table.SetHeader(hdrs)
-			var render bool
-
-			if params.OutFile != "" {
-				f, err = os.Create(params.OutFile)
-				if err != nil {
-					fnerr(err)
-					return
-				}
-
-				wf = csv.NewWriter(f)
-				defer func() {
-					wf.Flush()
-					f.Close()
-				}()
-
-				switch params.OutFmt {
-				case "csv":
-					wf.Write(hdrs)
-				case "json":
-				default:
-					fnerr(fmt.Errorf("unsupported output format"))
-					return
-				}
-			}
-
 			switch {
 			case rawInput != "":
 				var in cost.ListCalculationsHistoryRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				if in.Vendor == "" {
@@ -415,8 +223,7 @@ func ListHistoryCmd() *cobra.Command {
 
 				resp, err = client.ListCalculationsHistory(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				resp, err = client.ListCalculationsHistory(ctx, &cost.ListCalculationsHistoryRequest{
@@ -424,11 +231,19 @@ func ListHistoryCmd() *cobra.Command {
 				})
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			}
 
+			w, err := output.New(output.Input{
+				Headers: []string{"NAME", "MONTH", "GROUPS", "UPDATED", "CREATED", "STATUS", "DONE", "RESULT"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
 			for _, op := range resp.Aws.Operations {
 				var sm structpb.Struct
 				op.Metadata.UnmarshalTo(&sm)
@@ -442,75 +257,32 @@ func ListHistoryCmd() *cobra.Command {
 					result = terr.Error.String()
 				}
 
-				switch {
-				case params.OutFmt == "csv" && params.OutFile != "":
-					b, _ := json.Marshal(meta)
-					var cm CalculateCostsMeta
-					json.Unmarshal(b, &cm)
-					wf.Write([]string{
-						op.Name,
-						cm.Month,
-						strings.Join(cm.GroupIds, ","),
-						cm.Updated,
-						cm.Created,
-						cm.Status,
-						fmt.Sprintf("%v", op.Done),
-						result,
-					})
-				case params.OutFmt == "json":
-					var m map[string]interface{}
-					b, _ := json.Marshal(op)
-					json.Unmarshal(b, &m)
-
-					// Make metadata more readable.
-					v := m["metadata"]
-					vv := v.(map[string]interface{})
-					vv["value"] = meta
-
-					// Make result more readable.
-					switch op.Result.(type) {
-					case *protosinternal.Operation_Response:
-						var res api.KeyValue
-						tres := op.Result.(*protosinternal.Operation_Response)
-						anypb.UnmarshalTo(tres.Response, &res, proto.UnmarshalOptions{})
-						v := m["Result"]
-						vv := v.(map[string]interface{})
-						vvv := vv["Response"].(map[string]interface{})
-						vvv["value"] = res
-					}
-
-					b, _ = json.Marshal(m)
-					fmt.Println(string(b))
-				default:
-					render = true
-					b, _ := json.Marshal(meta)
-					var cm CalculateCostsMeta
-					json.Unmarshal(b, &cm)
-					table.Append([]string{
-						op.Name,
-						cm.Month,
-						strings.Join(cm.GroupIds, ","),
-						cm.Updated,
-						cm.Created,
-						cm.Status,
-						fmt.Sprintf("%v", op.Done),
-						result,
-					})
+				b, _ := json.Marshal(meta)
+				var cm CalculateCostsMeta
+				json.Unmarshal(b, &cm)
+				row := []string{
+					op.Name,
+					cm.Month,
+					strings.Join(cm.GroupIds, ","),
+					cm.Updated,
+					cm.Created,
+					cm.Status,
+					fmt.Sprintf("%v", op.Done),
+					result,
 				}
-			}
 
-			if render {
-				table.Render()
+				err = w.Append(row, op)
+				if err != nil {
+					return err
+				}
 			}
 
-			if params.OutFile != "" {
-				logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
-			}
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ListCalculationsHistory")
+	rawinput.Flag(cmd, &rawInput, &cost.ListCalculationsHistoryRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ListCalculationsHistory")
 	return cmd
 }
 
@@ -530,25 +302,12 @@ billingInternalId/billingGroupId (yyyymm):
 
 Timestamps are ordered with the topmost as most recent. 'cur'-triggered means this calculation was
 triggered by updates to the CUR while 'invoice' means by a manual invoice request.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			month = time.Now().UTC().Format("200601")
 			if len(args) > 0 {
 				mm, err := time.Parse("200601", args[0])
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				} else {
 					month = mm.Format("200601")
 				}
@@ -559,17 +318,15 @@ triggered by updates to the CUR while 'invoice' means by a manual invoice reques
 				groupId = args[1]
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.BillingService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := billing.NewClient(ctx, &billing.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -579,28 +336,13 @@ triggered by updates to the CUR while 'invoice' means by a manual invoice reques
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
-
-					wf.Write([]string{
+			case output.Format() != output.FormatTable || params.OutFile != "":
+				w, err := output.New(output.Input{
+					Keys: []string{
 						"billingInternalId",
 						"billingGroupId",
 						"month",
@@ -608,74 +350,71 @@ triggered by updates to the CUR while 'invoice' means by a manual invoice reques
 						"timestamp",
 						"trigger",
 						"after",
-					})
+					},
+				})
 
-					for {
-						v, err := stream.Recv()
-						if err == io.EOF {
-							break
-						}
+				if err != nil {
+					return err
+				}
 
-						if err != nil {
-							fnerr(err)
-							return
-						}
+				defer w.Close()
+				for {
+					v, err := stream.Recv()
+					if err == io.EOF {
+						break
+					}
 
-						if len(v.Accounts) == 0 {
-							continue
-						}
+					if err != nil {
+						return err
+					}
+
+					if len(v.Accounts) == 0 {
+						continue
+					}
 
-						for _, acct := range v.Accounts {
-							if len(acct.History) > 0 {
-								var itr int
-								var updated bool // after invoice
-								for _, h := range acct.History {
-									itr++
-									if h.Trigger == "invoice" {
-										if itr > 1 {
-											updated = true
-										}
-										break
+					for _, acct := range v.Accounts {
+						if len(acct.History) > 0 {
+							var itr int
+							var updated bool // after invoice
+							for _, h := range acct.History {
+								itr++
+								if h.Trigger == "invoice" {
+									if itr > 1 {
+										updated = true
 									}
+									break
 								}
+							}
 
-								for _, h := range acct.History {
-									if updated && h.Trigger == "invoice" {
-										updated = false
-									}
+							for _, h := range acct.History {
+								if updated && h.Trigger == "invoice" {
+									updated = false
+								}
 
-									var row []string
-									if updated && h.Trigger != "invoice" {
-										row = []string{
-											v.BillingInternalId,
-											v.BillingGroupId,
-											v.Month,
-											acct.AccountId,
-											h.Timestamp,
-											h.Trigger,
-											"yes",
-										}
-									} else {
-										row = []string{
-											v.BillingInternalId,
-											v.BillingGroupId,
-											v.Month,
-											acct.AccountId,
-											h.Timestamp,
-											h.Trigger,
-											"",
-										}
-									}
+								var after string
+								if updated && h.Trigger != "invoice" {
+									after = "yes"
+								}
 
-									logger.Infof("%v --> %v", row, params.OutFile)
-									wf.Write(row)
+								err = w.Append([]string{
+									v.BillingInternalId,
+									v.BillingGroupId,
+									v.Month,
+									acct.AccountId,
+									h.Timestamp,
+									h.Trigger,
+									after,
+								})
+
+								if err != nil {
+									return err
 								}
 							}
 						}
 					}
 				}
-			case params.OutFmt == "json":
-				logger.Info("format not supported yet")
+
+				return w.Close()
 			default:
 				for {
 					v, err := stream.Recv()
@@ -684,8 +423,7 @@ triggered by updates to the CUR while 'invoice' means by a manual invoice reques
 					}
 
 					if err != nil {
-						fnerr(err)
-						return
+						return err
 					}
 
 					if len(v.Accounts) == 0 {
@@ -724,6 +462,8 @@ triggered by updates to the CUR while 'invoice' means by a manual invoice reques
 					}
 				}
 			}
+
+			return nil
 		},
 	}
 
@@ -1,105 +1,82 @@
 package schedule
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/complete"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
-	"github.com/olekukonko/tablewriter"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
 	"github.com/spf13/cobra"
 )
 
+var scheduleHeaders = []string{
+	"ID",
+	"SCHEDULE",
+	"SCHEDULE_MACRO",
+	"TARGET_MONTH",
+	"NEXT_RUN",
+	"NOTIFICATION_CHANNEL",
+	"DRYRUN",
+}
+
+func scheduleRow(v *cost.CalculationsSchedule) []string {
+	tm := v.TargetMonth
+	if tm == "" {
+		tm = "-"
+	}
+
+	return []string{
+		v.Id,
+		v.Schedule,
+		v.ScheduleMacro,
+		tm,
+		v.NextRun,
+		v.NotificationChannel,
+		fmt.Sprintf("%v", v.DryRun),
+	}
+}
+
 func ListCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List calculation schedules",
 		Long:  `List calculation schedules.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			con, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: con})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			resp, err := client.ListCalculationsSchedules(ctx, &cost.ListCalculationsSchedulesRequest{Vendor: "aws"})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			switch {
-			case params.OutFmt == "json":
-				b, _ := json.Marshal(resp)
-				if err != nil {
-					fnerr(err)
-					return
-				}
+			w, err := output.New(output.Input{Headers: scheduleHeaders})
+			if err != nil {
+				return err
+			}
 
-				fmt.Printf("%v", string(b))
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader([]string{
-					"ID",
-					"SCHEDULE",
-					"SCHEDULE_MACRO",
-					"TARGET_MONTH",
-					"NEXT_RUN",
-					"NOTIFICATION_CHANNEL",
-					"DRYRUN",
-				})
-
-				if len(resp.Schedules) > 0 {
-					tm := resp.Schedules[0].TargetMonth
-					if tm == "" {
-						tm = "-"
-					}
-
-					table.Append([]string{
-						resp.Schedules[0].Id,
-						resp.Schedules[0].Schedule,
-						resp.Schedules[0].ScheduleMacro,
-						tm,
-						resp.Schedules[0].NextRun,
-						resp.Schedules[0].NotificationChannel,
-						fmt.Sprintf("%v", resp.Schedules[0].DryRun),
-					})
+			defer w.Close()
+			for _, v := range resp.Schedules {
+				err = w.Append(scheduleRow(v), v)
+				if err != nil {
+					return err
 				}
-
-				table.Render()
 			}
+
+			return w.Close()
 		},
 	}
 
@@ -125,45 +102,29 @@ For example, if you want to schedule your calculation every 3rd day of the month
 
 You can get the notification channel id by using the command:
   bluectl notification channels list`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 && rawInput == "" {
-				fnerr(fmt.Errorf("id cannot be empty"))
-				return
+				return cmderr.Usage(fmt.Errorf("id cannot be empty"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			con, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: con})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			var r cost.CreateCalculationsScheduleRequest
 			switch {
 			case rawInput != "":
-				err := json.Unmarshal([]byte(rawInput), &r)
+				err := rawinput.Unmarshal(rawInput, &r)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				r = cost.CreateCalculationsScheduleRequest{
@@ -180,19 +141,23 @@ You can get the notification channel id by using the command:
 
 			resp, err := client.CreateCalculationsSchedule(ctx, &r)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			b, _ := json.Marshal(resp)
-			logger.Info(string(b))
+			err = output.Print(output.Input{Headers: scheduleHeaders}, scheduleRow(resp), resp)
+			if err != nil {
+				return err
+			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://labs.alphaus.cloud/blueapidocs/#/Cost/Cost_CreateCalculationsSchedule")
+	rawinput.Flag(cmd, &rawInput, &cost.CreateCalculationsScheduleRequest{}, "https://labs.alphaus.cloud/blueapidocs/#/Cost/Cost_CreateCalculationsSchedule")
 	cmd.Flags().StringVar(&notifyChan, "notification-channel", notifyChan, "notification channel id; if empty, creates a channel using your email")
 	cmd.Flags().BoolVar(&dryrun, "dryrun", dryrun, "if true, simulate notification only, no actual calculation")
+	cmd.RegisterFlagCompletionFunc("notification-channel", complete.Flag(complete.Channels))
 	return cmd
 }
 
@@ -201,22 +166,9 @@ func DeleteCmd() *cobra.Command {
 		Use:   "rm <id|-|.>",
 		Short: "Delete calculation schedules",
 		Long:  `Delete calculation schedules. Accepts an id, or '-', or '.', which means all.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("id cannot be empty"))
-				return
+				return cmderr.Usage(fmt.Errorf("id cannot be empty"))
 			}
 
 			id := args[0]
@@ -224,28 +176,26 @@ func DeleteCmd() *cobra.Command {
 				id = "*"
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			con, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: con})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			r := cost.DeleteCalculationsScheduleRequest{Vendor: "aws", Id: id}
 			_, err = client.DeleteCalculationsSchedule(ctx, &r)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Infof("[%v] deleted", args[0])
+			return nil
 		},
 	}
 
@@ -1,19 +1,43 @@
 package costmods
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
 	"github.com/spf13/cobra"
 )
 
+var modHeaders = []string{
+	"ID",
+	"ACCOUNT_ID",
+	"GROUP_ID",
+	"PAYER_ID",
+	"FORMULA",
+	"AFTER",
+	"UPDATE_TIME",
+}
+
+func modRow(v *cost.CalculatorCostModifier) []string {
+	var account, group, payer, formula, after string
+	if v.AwsOptions != nil {
+		account = v.AwsOptions.AccountId
+		group = v.AwsOptions.GroupId
+		payer = v.AwsOptions.PayerId
+		after = v.AwsOptions.After
+		if v.AwsOptions.Modifier != nil {
+			formula = v.AwsOptions.Modifier.Formula
+		}
+	}
+
+	return []string{v.Id, account, group, payer, formula, after, v.UpdateTime}
+}
+
 func ListCmd() *cobra.Command {
 	var (
 		rawInput string
@@ -24,30 +48,16 @@ func ListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List cost modifiers",
 		Long:  `List cost modifiers.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -56,10 +66,19 @@ func ListCmd() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
+			w, err := output.New(output.Input{
+				Headers:  modHeaders,
+				ColWidth: colWidth,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -67,18 +86,16 @@ func ListCmd() *cobra.Command {
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				switch params.OutFmt {
-				case "json":
-					b, _ := json.Marshal(v)
-					logger.Info(string(b))
-				default:
-					logger.Info(v)
+				err = w.Append(modRow(v), v)
+				if err != nil {
+					return err
 				}
 			}
+
+			return w.Close()
 		},
 	}
 
@@ -97,56 +114,54 @@ func CreateCmd() *cobra.Command {
 		Use:   "create",
 		Short: "Create a cost modifier",
 		Long:  `Create a cost modifier.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if rawInput == "" {
-				fnerr(fmt.Errorf("--raw-input is required for this cmd"))
+				return cmderr.Usage(fmt.Errorf("--raw-input is required for this cmd"))
 			}
 
 			var in cost.CreateCalculatorCostModifierRequest
-			err := json.Unmarshal([]byte(rawInput), &in)
+			err := rawinput.Unmarshal(rawInput, &in)
 			if err != nil {
-				fnerr(fmt.Errorf("--raw-input is invalid"))
+				return err
 			}
 
 			in.Vendor = "aws"
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			resp, err := client.CreateCalculatorCostModifier(ctx, &in)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			logger.Info(resp)
+			w, err := output.New(output.Input{Headers: modHeaders})
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for _, v := range resp.Aws {
+				err = w.Append(modRow(v), v)
+				if err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_CreateCalculatorCostModifier")
+	rawinput.Flag(cmd, &rawInput, &cost.CreateCalculatorCostModifierRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_CreateCalculatorCostModifier")
 	return cmd
 }
 
@@ -155,34 +170,20 @@ func DelCmd() *cobra.Command {
 		Use:   "rm <id>",
 		Short: "Delete a cost modifier",
 		Long:  `Delete a cost modifier.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("id is required"))
+				return cmderr.Usage(fmt.Errorf("id is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -192,11 +193,11 @@ func DelCmd() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Infof("%v deleted", args[0])
+			return nil
 		},
 	}
 
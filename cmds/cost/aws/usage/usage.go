@@ -2,23 +2,85 @@ package usage
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
 	"strings"
 	"time"
 
 	awstypes "github.com/alphauslabs/blue-sdk-go/api/aws"
 	"github.com/alphauslabs/blue-sdk-go/cost/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/alphauslabs/bluectl/pkg/retry"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
 )
 
+// csvKeys are the columns of csv outputs: all the fields of each item,
+// regardless of the enabled table columns.
+var csvKeys = []string{
+	"groupId",
+	"account",
+	"date",
+	"productCode",
+	"serviceCode",
+	"region",
+	"zone",
+	"usageType",
+	"instanceType",
+	"operation",
+	"invoiceId",
+	"description",
+	"resourceId",
+	"tags",
+	"costCategories",
+	"usageAmount",
+	"cost",
+	"baseCurrency",
+	"exchangeRate",
+	"targetCost",
+	"targetCurrency",
+	"effectiveCost",
+	"targetEffectiveCost",
+	"amortizedCost",
+	"targetAmortizedCost",
+}
+
+// csvRow returns the csvKeys values of v.
+func csvRow(v *awstypes.Cost, tags, cc string) []string {
+	return []string{
+		v.GroupId,
+		v.Account,
+		v.Date,
+		v.ProductCode,
+		v.ServiceCode,
+		v.Region,
+		v.Zone,
+		v.UsageType,
+		v.InstanceType,
+		v.Operation,
+		v.InvoiceId,
+		v.Description,
+		v.ResourceId,
+		tags,
+		cc,
+		fmt.Sprintf("%.9f", v.Usage),
+		fmt.Sprintf("%.9f", v.Cost),
+		v.BaseCurrency,
+		fmt.Sprintf("%.9f", v.ExchangeRate),
+		fmt.Sprintf("%.9f", v.TargetCost),
+		v.TargetCurrency,
+		fmt.Sprintf("%.9f", v.EffectiveCost),
+		fmt.Sprintf("%.9f", v.TargetEffectiveCost),
+		fmt.Sprintf("%.9f", v.AmortizedCost),
+		fmt.Sprintf("%.9f", v.TargetAmortizedCost),
+	}
+}
+
 type Flags struct {
 	RawInput              string
 	CostType              string
@@ -30,135 +92,19 @@ type Flags struct {
 	ColWidth              int
 }
 
-func get(cmd *cobra.Command, args []string, fl *Flags) {
-	var ret int
-	defer func(r *int) {
-		if *r != 0 {
-			os.Exit(*r)
-		}
-	}(&ret)
-
-	fnerr := func(e error) {
-		logger.Error(e)
-		ret = 1
-	}
-
-	ctx := context.Background()
+func get(cmd *cobra.Command, args []string, fl *Flags) error {
+	ctx := cmd.Context()
 	mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
 	if err != nil {
-		fnerr(err)
-		return
+		return err
 	}
 
 	client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
 	if err != nil {
-		fnerr(err)
-		return
+		return err
 	}
 
 	defer client.Close()
-	var f *os.File
-	var wf *csv.Writer
-
-	if params.OutFile != "" {
-		f, err = os.Create(params.OutFile)
-		if err != nil {
-			fnerr(err)
-			return
-		}
-
-		wf = csv.NewWriter(f)
-		defer func() {
-			wf.Flush()
-			f.Close()
-		}()
-
-		switch params.OutFmt {
-		case "csv":
-			wf.Write([]string{
-				"groupId",
-				"account",
-				"date",
-				"productCode",
-				"serviceCode",
-				"region",
-				"zone",
-				"usageType",
-				"instanceType",
-				"operation",
-				"invoiceId",
-				"description",
-				"resourceId",
-				"tags",
-				"costCategories",
-				"usageAmount",
-				"cost",
-				"baseCurrency",
-				"exchangeRate",
-				"targetCost",
-				"targetCurrency",
-				"effectiveCost",
-				"targetEffectiveCost",
-				"amortizedCost",
-				"targetAmortizedCost",
-			})
-		case "json":
-		default:
-			fnerr(fmt.Errorf("unsupported output format"))
-			return
-		}
-	}
-
-	fnWriteFile := func(v *awstypes.Cost) {
-		b, _ := json.Marshal(v)
-		fmt.Println(string(b))
-		if params.OutFile != "" {
-			var tags, cc string
-			if v.Tags != nil {
-				b, _ := json.Marshal(v.Tags)
-				tags = string(b)
-			}
-
-			if v.CostCategories != nil {
-				b, _ := json.Marshal(v.CostCategories)
-				cc = string(b)
-			}
-
-			switch params.OutFmt {
-			case "csv":
-				wf.Write([]string{
-					v.GroupId,
-					v.Account,
-					v.Date,
-					v.ProductCode,
-					v.ServiceCode,
-					v.Region,
-					v.Zone,
-					v.UsageType,
-					v.InstanceType,
-					v.Operation,
-					v.InvoiceId,
-					v.Description,
-					v.ResourceId,
-					tags,
-					cc,
-					fmt.Sprintf("%.9f", v.Usage),
-					fmt.Sprintf("%.9f", v.Cost),
-					v.BaseCurrency,
-					fmt.Sprintf("%.9f", v.ExchangeRate),
-					fmt.Sprintf("%.9f", v.TargetCost),
-					v.TargetCurrency,
-					fmt.Sprintf("%.9f", v.EffectiveCost),
-					fmt.Sprintf("%.9f", v.TargetEffectiveCost),
-					fmt.Sprintf("%.9f", v.AmortizedCost),
-					fmt.Sprintf("%.9f", v.TargetAmortizedCost),
-				})
-			case "json":
-				fmt.Fprintf(f, "%v\n", string(b))
-			}
-		}
-	}
-
 	type colT struct {
 		name   string
 		title  string
@@ -167,7 +113,6 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 		vfmt   string
 	}
 
-	var stream cost.Cost_ReadCostsClient
 	var in cost.ReadCostsRequest
 	cols := []string{}
 	refCols := []colT{
@@ -192,10 +137,9 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 
 	switch {
 	case fl.RawInput != "":
-		err := json.Unmarshal([]byte(fl.RawInput), &in)
+		err := rawinput.Unmarshal(fl.RawInput, &in)
 		if err != nil {
-			fnerr(err)
-			return
+			return err
 		}
 
 		if in.Vendor == "" {
@@ -230,16 +174,10 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 
 		refCols[13].enable = in.AwsOptions.IncludeTags
 		refCols[14].enable = in.AwsOptions.IncludeCostCategories
-		stream, err = client.ReadCosts(ctx, &in)
-		if err != nil {
-			fnerr(err)
-			return
-		}
 	default:
 		if fl.CostType != "all" {
 			if fl.Id == "" {
-				fnerr(fmt.Errorf("id is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("id is required"))
 			}
 		}
 
@@ -247,8 +185,7 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 		if fl.Start != "" {
 			ts, err = time.Parse("20060102", fl.Start)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 		}
@@ -256,8 +193,7 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 		if fl.End != "" {
 			te, err = time.Parse("20060102", fl.End)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 		}
 
@@ -277,23 +213,25 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 		case "billinggroup":
 			in.GroupId = fl.Id
 		default:
-			fnerr(fmt.Errorf("type unsupported: %v", fl.CostType))
-			return
-		}
-
-		stream, err = client.ReadCosts(ctx, &in)
-		if err != nil {
-			fnerr(err)
-			return
+			return cmderr.Usage(fmt.Errorf("type unsupported: %v", fl.CostType))
 		}
 	}
 
+	keys := []string{}
 	for _, v := range refCols {
 		if v.enable {
 			cols = append(cols, v.title)
+			keys = append(keys, v.name)
 		}
 	}
 
+	// Only the table is limited to the enabled columns; json and yaml have
+	// all the fields of each item.
+	isCsv := output.Format() == output.FormatCsv
+	if isCsv {
+		keys = csvKeys
+	}
+
 	colsAlign := []int{}
 	for _, col := range cols {
 		switch {
@@ -306,96 +244,104 @@ func get(cmd *cobra.Command, args []string, fl *Flags) {
 		}
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	// table.SetAutoFormatHeaders(false)
-	// table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	// table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetColWidth(fl.ColWidth)
-	table.SetAutoWrapText(false)
-	table.SetBorder(false)
-	table.SetHeaderLine(false)
-	table.SetColumnSeparator("")
-	table.SetTablePadding("  ")
-	table.SetNoWhiteSpace(true)
-	// table.SetHeader(cols)
-	table.SetColumnAlignment(colsAlign)
-	table.Append(cols)
-	var render bool
+	w, err := output.New(output.Input{
+		Headers:  cols,
+		Keys:     keys,
+		Align:    colsAlign,
+		ColWidth: fl.ColWidth,
+		NoWrap:   true,
+		Progress: true,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer w.Close()
 	var totalUsage, totalCost float64
+	stream := retry.Stream[*cost.CostItem]{
+		Open: func(ctx context.Context, from string) (retry.Receiver[*cost.CostItem], error) {
+			req := proto.Clone(&in).(*cost.ReadCostsRequest)
+			if from != "" {
+				req.StartTime = from
+			}
 
-	for {
-		v, err := stream.Recv()
-		if err == io.EOF {
-			break
+			return client.ReadCosts(ctx, req)
+		},
+		Date: func(v *cost.CostItem) string { return v.Aws.GetDate() },
+	}
+
+	err = stream.Do(ctx, func(v *cost.CostItem) error {
+		var tags, cc string
+		if v.Aws.Tags != nil {
+			b, _ := json.Marshal(v.Aws.Tags)
+			tags = string(b)
 		}
 
-		if err != nil {
-			fnerr(err)
-			return
+		if v.Aws.CostCategories != nil {
+			b, _ := json.Marshal(v.Aws.CostCategories)
+			cc = string(b)
 		}
 
-		switch {
-		case params.OutFile != "":
-			fnWriteFile(v.Aws)
-		default:
-			render = true
-			refCols[0].val = v.Aws.GroupId
-			refCols[1].val = v.Aws.Account
-			refCols[2].val = v.Aws.Date
-			refCols[3].val = v.Aws.ProductCode
-			refCols[4].val = v.Aws.ServiceCode
-			refCols[5].val = v.Aws.Region
-			refCols[6].val = v.Aws.Zone
-			refCols[7].val = v.Aws.UsageType
-			refCols[8].val = v.Aws.InstanceType
-			refCols[9].val = v.Aws.Operation
-			refCols[10].val = v.Aws.InvoiceId
-			refCols[11].val = v.Aws.Description
-			refCols[12].val = v.Aws.ResourceId
-			refCols[13].val = v.Aws.Tags
-			refCols[14].val = v.Aws.CostCategories
-			refCols[15].val = v.Aws.Usage
-			refCols[16].val = v.Aws.Cost
-			totalUsage += v.Aws.Usage
-			totalCost += v.Aws.Cost
-			row := []string{}
-			for _, rc := range refCols {
-				if rc.enable {
-					vfmt := "%v"
-					if rc.vfmt != "" {
-						vfmt = rc.vfmt
-					}
+		refCols[0].val = v.Aws.GroupId
+		refCols[1].val = v.Aws.Account
+		refCols[2].val = v.Aws.Date
+		refCols[3].val = v.Aws.ProductCode
+		refCols[4].val = v.Aws.ServiceCode
+		refCols[5].val = v.Aws.Region
+		refCols[6].val = v.Aws.Zone
+		refCols[7].val = v.Aws.UsageType
+		refCols[8].val = v.Aws.InstanceType
+		refCols[9].val = v.Aws.Operation
+		refCols[10].val = v.Aws.InvoiceId
+		refCols[11].val = v.Aws.Description
+		refCols[12].val = v.Aws.ResourceId
+		refCols[13].val = tags
+		refCols[14].val = cc
+		refCols[15].val = v.Aws.Usage
+		refCols[16].val = v.Aws.Cost
+		totalUsage += v.Aws.Usage
+		totalCost += v.Aws.Cost
+		if isCsv {
+			return w.Append(csvRow(v.Aws, tags, cc))
+		}
 
-					row = append(row, fmt.Sprintf(vfmt, rc.val))
+		row := []string{}
+		for _, rc := range refCols {
+			if rc.enable {
+				vfmt := "%v"
+				if rc.vfmt != "" {
+					vfmt = rc.vfmt
 				}
-			}
-
-			fmt.Printf("\033[2K\rrecv:%v...", row)
-			table.Append(row)
-		}
-	}
 
-	if render {
-		// Add the total line.
-		totalLine := []string{}
-		if (len(cols) - 3) > 0 {
-			for i := 0; i < len(cols)-3; i++ {
-				totalLine = append(totalLine, "")
+				row = append(row, fmt.Sprintf(vfmt, rc.val))
 			}
 		}
 
-		totalLine = append(totalLine, "TOTAL")
-		totalLine = append(totalLine, fmt.Sprintf("%.10f", totalUsage))
-		totalLine = append(totalLine, fmt.Sprintf("%.10f", totalCost))
-		table.Append(totalLine)
+		return w.Append(row, v.Aws)
+	})
 
-		fmt.Printf("\033[2K\r") // reset cursor
-		table.Render()
+	if err != nil {
+		return err
 	}
 
-	if params.OutFile != "" {
-		logger.Infof("data written to %v in %v format", params.OutFile, params.OutFmt)
+	// Add the total line.
+	totalLine := []string{}
+	if (len(cols) - 3) > 0 {
+		for i := 0; i < len(cols)-3; i++ {
+			totalLine = append(totalLine, "")
+		}
 	}
+
+	totalLine = append(totalLine, "TOTAL")
+	totalLine = append(totalLine, fmt.Sprintf("%.10f", totalUsage))
+	totalLine = append(totalLine, fmt.Sprintf("%.10f", totalCost))
+	err = w.Footer(totalLine)
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
 }
 
 func GetCmd() *cobra.Command {
@@ -406,13 +352,13 @@ func GetCmd() *cobra.Command {
 		Long: `Read AWS usage-based costs. At the moment, we recommend you to use the --raw-input flag to take advantage
 of the API's full features described in https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadCosts.
 Note that this will invalidate all the other flags.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			get(cmd, args, &fl)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return get(cmd, args, &fl)
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&fl.RawInput, "raw-input", fl.RawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadCosts")
+	rawinput.Flag(cmd, &fl.RawInput, &cost.ReadCostsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Cost/Cost_ReadCosts")
 	cmd.Flags().StringVar(&fl.CostType, "type", "account", "type of cost to read: all, account, billinggroup")
 	cmd.Flags().StringVar(&fl.Id, "id", fl.Id, "account id or billing group id, depending on --type, skipped if 'all'")
 	cmd.Flags().StringVar(&fl.Start, "start", time.Now().UTC().Format("200601")+"01", "yyyymmdd: start date to stream data; default: first day of the current month (UTC)")
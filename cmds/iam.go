@@ -1,18 +1,16 @@
 package cmds
 
 import (
-	"context"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"sort"
+	"strings"
 
 	"github.com/alphauslabs/blue-sdk-go/iam/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
-	"github.com/olekukonko/tablewriter"
+	"github.com/alphauslabs/bluectl/pkg/output"
 	"github.com/spf13/cobra"
 )
 
@@ -21,119 +19,50 @@ func IamUserListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List subusers",
 		Long:  `List subusers.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			stream, err := client.ListUsers(ctx, &iam.ListUsersRequest{})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			hdrs := []string{"ID", "PARENT"}
-
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
-
-					wf.Write(hdrs)
-					for {
-						v, err := stream.Recv()
-						if err == io.EOF {
-							break
-						}
-
-						if err != nil {
-							fnerr(err)
-							return
-						}
-
-						row := []string{v.Id, v.Parent}
-						logger.Infof("%v --> %v", row, params.OutFile)
-						wf.Write(row)
-					}
-				}
-			case params.OutFmt == "json":
-				for {
-					v, err := stream.Recv()
-					if err == io.EOF {
-						break
-					}
-
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					b, _ := json.Marshal(v)
-					logger.Info(string(b))
+			w, err := output.New(output.Input{
+				Headers: []string{"ID", "PARENT"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for {
+				v, err := stream.Recv()
+				if err == io.EOF {
+					break
 				}
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader(hdrs)
-
-				for {
-					v, err := stream.Recv()
-					if err == io.EOF {
-						break
-					}
-
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					table.Append([]string{v.Id, v.Parent})
+
+				if err != nil {
+					return err
 				}
 
-				table.Render()
+				err = w.Append([]string{v.Id, v.Parent}, v)
+				if err != nil {
+					return err
+				}
 			}
+
+			return w.Close()
 		},
 	}
 
@@ -146,102 +75,43 @@ func IamUserGetCmd() *cobra.Command {
 		Use:   "get <id>",
 		Short: "Get subuser information",
 		Long:  `Get subuser information.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("id is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("id is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			resp, err := client.GetUser(ctx, &iam.GetUserRequest{Id: args[0]})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			hdrs := []string{"ID", "PARENT", "METADATA"}
-
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
-
-					wf.Write(hdrs)
-					for k, v := range resp.Metadata {
-						m := fmt.Sprintf("%v: %v", k, v)
-						row := []string{resp.Id, resp.Parent, m}
-						logger.Infof("%v --> %v", row, params.OutFile)
-						wf.Write(row)
-					}
-				}
-			case params.OutFmt == "json":
-				b, _ := json.Marshal(resp)
-				logger.Info(string(b))
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader(hdrs)
-
-				first := true
-				for k, v := range resp.Metadata {
-					m := fmt.Sprintf("%v: %v", k, v)
-					if first {
-						row := []string{resp.Id, resp.Parent, m}
-						table.Append(row)
-						first = false
-					} else {
-						row := []string{"-", "-", m}
-						table.Append(row)
-					}
-				}
+			var md []string
+			for k, v := range resp.Metadata {
+				md = append(md, fmt.Sprintf("%v: %v", k, v))
+			}
+
+			sort.Strings(md)
+			err = output.Print(output.Input{
+				Headers: []string{"ID", "PARENT", "METADATA"},
+			}, []string{resp.Id, resp.Parent, strings.Join(md, "\n")}, resp)
 
-				table.Render()
+			if err != nil {
+				return err
 			}
+
+			return nil
 		},
 	}
 
@@ -277,37 +147,22 @@ func IamIpFilterListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List IP filter rules",
 		Long:  `List IP filter rules.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			stream, err := client.ListIpFilters(ctx, &iam.ListIpFiltersRequest{})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			hdrs := []string{"TYPE", "TARGET", "SCOPE", "VALUE"}
@@ -315,51 +170,40 @@ func IamIpFilterListCmd() *cobra.Command {
 				hdrs = append(hdrs, "ID")
 			}
 
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				fallthrough
-			case params.OutFmt == "json":
-				logger.Info("not supported at the moment")
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetAlignment(tablewriter.ALIGN_LEFT)
-				// table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader(hdrs)
-
-				for {
-					v, err := stream.Recv()
-					if err == io.EOF {
-						break
-					}
-
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					add := []string{
-						v.Type,
-						v.Target,
-						v.Scope,
-						v.Value,
-					}
-
-					if withId {
-						add = append(add, v.Id)
-					}
-
-					table.Append(add)
+			w, err := output.New(output.Input{Headers: hdrs})
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for {
+				v, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					return err
+				}
+
+				row := []string{
+					v.Type,
+					v.Target,
+					v.Scope,
+					v.Value,
+				}
+
+				if withId {
+					row = append(row, v.Id)
 				}
 
-				table.Render()
+				err = w.Append(row, v)
+				if err != nil {
+					return err
+				}
 			}
+
+			return w.Close()
 		},
 	}
 
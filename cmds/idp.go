@@ -1,18 +1,15 @@
 package cmds
 
 import (
-	"context"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
 
 	"github.com/alphauslabs/blue-sdk-go/iam/v1"
-	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/complete"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
-	"github.com/olekukonko/tablewriter"
+	"github.com/alphauslabs/bluectl/pkg/output"
 	"github.com/spf13/cobra"
 )
 
@@ -21,89 +18,41 @@ func ListIdpsCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List IdPs",
 		Long:  `List IdPs.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			resp, err := client.ListIdentityProviders(ctx, &iam.ListIdentityProvidersRequest{})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			hdrs := []string{"ID", "NAME", "TYPE"}
-
-			switch {
-			case params.OutFile != "" && params.OutFmt == "csv":
-				if params.OutFile != "" {
-					var f *os.File
-					var wf *csv.Writer
-					f, err = os.Create(params.OutFile)
-					if err != nil {
-						fnerr(err)
-						return
-					}
-
-					wf = csv.NewWriter(f)
-					defer func() {
-						wf.Flush()
-						f.Close()
-					}()
-
-					wf.Write(hdrs)
-					for _, d := range resp.Data {
-						row := []string{d.Id, d.Name, d.Type}
-						logger.Infof("%v --> %v", row, params.OutFile)
-						wf.Write(row)
-					}
-				}
-			case params.OutFmt == "json":
-				for _, d := range resp.Data {
-					b, _ := json.Marshal(d)
-					logger.Info(string(b))
-				}
-			default:
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoFormatHeaders(false)
-				table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-				table.SetAlignment(tablewriter.ALIGN_LEFT)
-				table.SetColWidth(100)
-				table.SetBorder(false)
-				table.SetHeaderLine(false)
-				table.SetColumnSeparator("")
-				table.SetTablePadding("  ")
-				table.SetNoWhiteSpace(true)
-				table.SetHeader(hdrs)
-
-				for _, d := range resp.Data {
-					table.Append([]string{d.Id, d.Name, d.Type})
-				}
+			w, err := output.New(output.Input{
+				Headers: []string{"ID", "NAME", "TYPE"},
+			})
+
+			if err != nil {
+				return err
+			}
 
-				table.Render()
+			defer w.Close()
+			for _, d := range resp.Data {
+				err = w.Append([]string{d.Id, d.Name, d.Type}, d)
+				if err != nil {
+					return err
+				}
 			}
+
+			return w.Close()
 		},
 	}
 
@@ -116,41 +65,25 @@ func CreateIdpCmd() *cobra.Command {
 		Use:   "create <name> <path-to-metadata-file>",
 		Short: "Create a new IdP entry",
 		Long:  `Create a new IdP entry.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 2 {
-				fnerr(fmt.Errorf("name and metadata file required"))
-				return
+				return cmderr.Usage(fmt.Errorf("name and metadata file required"))
 			}
 
 			meta, err := ioutil.ReadFile(args[1])
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -161,11 +94,11 @@ func CreateIdpCmd() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Infof("IdP %v created.", args[0])
+			return nil
 		},
 	}
 
@@ -178,49 +111,35 @@ func DelIdpCmd() *cobra.Command {
 		Use:   "rm <id>",
 		Short: "Delete IdP",
 		Long:  `Delete IdP entry.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("id is required"))
-				return
+				return cmderr.Usage(fmt.Errorf("id is required"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			_, err = client.DeleteIdentityProvider(ctx, &iam.DeleteIdentityProviderRequest{Id: args[0]})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Infof("deleted: %v", args[0])
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.Idps)
 	return cmd
 }
 
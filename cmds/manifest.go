@@ -0,0 +1,239 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/manifest"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var manifestHelp = `A manifest is a YAML stream of documents, each with a kind and a spec. Specs use the same
+fields as the --raw-input of the matching create command (camelCase). Supported kinds:
+
+  NotificationChannel   key: name
+  IdentityProvider      key: name
+  IpFilter              key: the whole spec (changes are a delete and a create)
+  CostModifier          key: the whole spec (aws only)
+  CalculationSchedule   key: none (one per account)
+
+Only the kinds present in the manifests are reconciled; use --prune to also delete the
+resources of those kinds that are not in the manifests. For example:
+
+  kind: NotificationChannel
+  spec:
+    name: finance
+    type: email
+    email:
+      recipients: [finance@example.com]
+  ---
+  kind: IpFilter
+  spec:
+    type: whitelist
+    value: 192.168.0.0/24
+
+Use 'bluectl export' to get the current state as a manifest.`
+
+func ApplyCmd() *cobra.Command {
+	var (
+		files []string
+		prune bool
+		yes   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply -f <file|dir|->",
+		Short: "Apply configuration manifests",
+		Long: `Create, update, or delete resources to match the desired state in manifests.
+Run 'bluectl diff' first to review the changes. If the changes include deletes or
+replaces, they are listed and need to be confirmed, or use --yes to skip the prompt.
+Replaces create the new resource before deleting the current one, except for the
+CalculationSchedule kind.
+
+` + manifestHelp,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(files) == 0 {
+				return cmderr.Usage(fmt.Errorf("-f is required"))
+			}
+
+			objs, err := manifest.Read(files)
+			if err != nil {
+				return cmderr.Usage(err)
+			}
+
+			ctx := cmd.Context()
+			var c manifest.Clients
+			defer c.Close()
+			changes, warnings, err := manifest.Plan(ctx, &c, objs, prune)
+			if err != nil {
+				return err
+			}
+
+			for _, w := range warnings {
+				logger.Infof("warning: %v", w)
+			}
+
+			if len(changes) == 0 {
+				logger.Info("no changes")
+				return nil
+			}
+
+			if !yes && slices.ContainsFunc(changes, (*manifest.Change).Destructive) {
+				for _, ch := range changes {
+					fmt.Printf("# %v %v [%v]\n", ch.Op, ch.Kind, ch.Title())
+				}
+
+				if slices.Contains(files, "-") || !term.IsTerminal(int(os.Stdin.Fd())) {
+					return cmderr.Usage(fmt.Errorf("changes include deletes or replaces, use --yes to apply"))
+				}
+
+				var rep string
+				fmt.Printf("Apply %v change(s)? [y/N]: ", len(changes))
+				fmt.Scanln(&rep)
+				if strings.ToLower(rep) != "y" {
+					logger.Info("cancelled, no changes applied")
+					return nil
+				}
+			}
+
+			for i, ch := range changes {
+				err = manifest.Apply(ctx, &c, ch)
+				if err != nil {
+					return fmt.Errorf("%w (%v of %v change(s) applied before the error)", err, i, len(changes))
+				}
+
+				logger.Infof("%v: %v [%v]", ch.Op, ch.Kind, ch.Title())
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringSliceVarP(&files, "file", "f", files, "manifest file, or directory of *.yaml files, or - for stdin, repeatable")
+	cmd.Flags().BoolVar(&prune, "prune", prune, "delete resources of the kinds in the manifests that are not in the manifests")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", yes, "apply deletes and replaces without confirmation")
+	return cmd
+}
+
+func DiffCmd() *cobra.Command {
+	var (
+		files    []string
+		prune    bool
+		exitCode bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff -f <file|dir|->",
+		Short: "Show the changes 'apply' would make",
+		Long: `Show the changes 'bluectl apply' would make, without making them. Lines starting with '+'
+are added, '-' are removed.
+
+` + manifestHelp,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(files) == 0 {
+				return cmderr.Usage(fmt.Errorf("-f is required"))
+			}
+
+			objs, err := manifest.Read(files)
+			if err != nil {
+				return cmderr.Usage(err)
+			}
+
+			ctx := cmd.Context()
+			var c manifest.Clients
+			defer c.Close()
+			changes, warnings, err := manifest.Plan(ctx, &c, objs, prune)
+			if err != nil {
+				return err
+			}
+
+			for _, w := range warnings {
+				logger.Infof("warning: %v", w)
+			}
+
+			if len(changes) == 0 {
+				logger.Info("no changes")
+				return nil
+			}
+
+			for i, ch := range changes {
+				if i > 0 {
+					fmt.Println()
+				}
+
+				fmt.Printf("# %v %v [%v]\n", ch.Op, ch.Kind, ch.Title())
+				fmt.Print(manifest.Diff(ch.From, ch.To))
+			}
+
+			if exitCode {
+				return cmderr.WithCode(cmderr.ExitError, cmderr.ErrSilent)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringSliceVarP(&files, "file", "f", files, "manifest file, or directory of *.yaml files, or - for stdin, repeatable")
+	cmd.Flags().BoolVar(&prune, "prune", prune, "include deletes of resources of the kinds in the manifests that are not in the manifests")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", exitCode, "exit with 1 if there are changes")
+	return cmd
+}
+
+func ExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [kind...]",
+		Short: "Export configuration resources as a manifest",
+		Long: `Export the current configuration resources as a manifest for 'bluectl apply'. Exports all
+kinds if none are specified. Valid kinds: ` + strings.Join(manifest.Kinds(), ", ") + `.
+Writes to stdout, or to the file set by --out.`,
+		ValidArgs: manifest.Kinds(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, k := range args {
+				if !slices.Contains(manifest.Kinds(), k) {
+					return cmderr.Usage(fmt.Errorf("invalid kind %q, valid kinds: %v", k,
+						strings.Join(manifest.Kinds(), ", ")))
+				}
+			}
+
+			ctx := cmd.Context()
+			var c manifest.Clients
+			defer c.Close()
+			objs, err := manifest.Export(ctx, &c, args...)
+			if err != nil {
+				return err
+			}
+
+			if params.OutFile == "" {
+				return manifest.Encode(os.Stdout, objs)
+			}
+
+			f, err := os.Create(params.OutFile)
+			if err != nil {
+				return err
+			}
+
+			err = manifest.Encode(f, objs)
+			if e := f.Close(); e != nil && err == nil {
+				err = e
+			}
+
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("%v resource(s) written to %v", len(objs), params.OutFile)
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
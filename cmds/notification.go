@@ -1,17 +1,14 @@
 package cmds
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 
 	"github.com/alphauslabs/blue-sdk-go/admin/v1"
-	"github.com/alphauslabs/bluectl/params"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
 func ListChannelsCmd() *cobra.Command {
@@ -23,30 +20,16 @@ func ListChannelsCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List notification channels",
 		Long:  `List notification channels.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			con, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: con})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -54,51 +37,51 @@ func ListChannelsCmd() *cobra.Command {
 			switch {
 			case rawInput != "":
 				var in admin.ListNotificationChannelsRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				resp, err = client.ListNotificationChannels(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				resp, err = client.ListNotificationChannels(ctx, &admin.ListNotificationChannelsRequest{})
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			}
 
-			switch {
-			case params.OutFmt == "json":
-				b, _ := json.Marshal(resp)
-				if err != nil {
-					fnerr(err)
-					return
-				}
+			w, err := output.New(output.Input{
+				Headers: []string{"ID", "NAME", "TYPE", "ENABLED", "PRODUCT"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			for _, v := range resp.Channels {
+				err = w.Append([]string{
+					v.Id,
+					v.Name,
+					v.Type,
+					fmt.Sprintf("%v", v.Enabled),
+					v.Product,
+				}, v)
 
-				fmt.Printf("%v", string(b))
-			default:
-				var m admin.ListNotificationChannelsResponse
-				b, _ := json.Marshal(resp)
-				err = yaml.Unmarshal(b, &m)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
-
-				b, _ = yaml.Marshal(m)
-				fmt.Printf("%v", string(b))
 			}
+
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Admin/Admin_ListNotificationChannels")
+	rawinput.Flag(cmd, &rawInput, &admin.ListNotificationChannelsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Admin/Admin_ListNotificationChannels")
 	return cmd
 }
 
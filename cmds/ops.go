@@ -1,23 +1,23 @@
 package cmds
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/alphauslabs/blue-sdk-go/operations/v1"
-	"github.com/alphauslabs/blue-sdk-go/session"
 	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/complete"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
 	"github.com/alphauslabs/bluectl/pkg/ops"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/alphauslabs/bluectl/pkg/rest"
 	"github.com/spf13/cobra"
 )
 
@@ -30,30 +30,16 @@ func OpsListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List long-running operations",
 		Long:  `List long-running operations.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.OpsService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := operations.NewClient(ctx, &operations.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -62,25 +48,31 @@ func OpsListCmd() *cobra.Command {
 			switch {
 			case rawInput != "":
 				var in operations.ListOperationsRequest
-				err := json.Unmarshal([]byte(rawInput), &in)
+				err := rawinput.Unmarshal(rawInput, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				stream, err = client.ListOperations(ctx, &in)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			default:
 				stream, err = client.ListOperations(ctx, &operations.ListOperationsRequest{})
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 			}
 
+			w, err := output.New(output.Input{
+				Headers: []string{"NAME", "DONE"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
 			for {
 				v, err := stream.Recv()
 				if err == io.EOF {
@@ -88,18 +80,21 @@ func OpsListCmd() *cobra.Command {
 				}
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				b, _ := json.Marshal(v)
-				logger.Info(string(b))
+				err = w.Append([]string{v.Name, fmt.Sprintf("%v", v.Done)}, v)
+				if err != nil {
+					return err
+				}
 			}
+
+			return w.Close()
 		},
 	}
 
 	cmd.Flags().SortFlags = false
-	cmd.Flags().StringVar(&rawInput, "raw-input", rawInput, "raw JSON input; see https://alphauslabs.github.io/blueapidocs/#/Operations/Operations_ListOperations")
+	rawinput.Flag(cmd, &rawInput, &operations.ListOperationsRequest{}, "https://alphauslabs.github.io/blueapidocs/#/Operations/Operations_ListOperations")
 	return cmd
 }
 
@@ -108,79 +103,62 @@ func OpsGetCmd() *cobra.Command {
 		Use:   "get <name>",
 		Short: "Query a long-running operation",
 		Long:  `Query a long-running operation.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("<name> cannot be empty"))
-				return
+				return cmderr.Usage(fmt.Errorf("<name> cannot be empty"))
 			}
 
 			switch {
-			case params.OutFmt == "json":
-				// TODO: Support for accessing beta (next) environment.
-				s := session.New(
-					session.WithClientId(params.ClientId),
-					session.WithClientSecret(params.ClientSecret),
-				)
-
-				t, err := s.AccessToken()
+			case output.Format() == output.FormatJson:
+				// Simpler to get the raw JSON this way.
+				timeout := 60 * time.Second
+				if params.Timeout > 0 {
+					timeout = params.Timeout
+				}
+
+				rc, err := rest.New(timeout)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				// Simpler to get the raw JSON this way.
-				hc := &http.Client{Timeout: 60 * time.Second}
-				u := fmt.Sprintf("https://api.alphaus.cloud/m/blue/ops/v1/%v", args[0])
-				r, err := http.NewRequest(http.MethodGet, u, nil)
+				u := fmt.Sprintf("%v/m/blue/ops/v1/%v", rc.Base, args[0])
+				r, err := http.NewRequestWithContext(cmd.Context(), http.MethodGet, u, nil)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				r.Header.Add("Authorization", "Bearer "+t)
-				resp, err := hc.Do(r)
+				resp, err := rc.Do(r)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
+				defer resp.Body.Close()
 				if (resp.StatusCode / 100) != 2 {
-					fnerr(fmt.Errorf(resp.Status))
-					return
+					return cmderr.HttpError(resp)
 				}
 
-				defer resp.Body.Close()
 				body, err := ioutil.ReadAll(resp.Body)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				logger.Info(string(body))
+				err = output.Print(output.Input{
+					Headers: []string{"NAME", "DONE"},
+				}, nil, json.RawMessage(body))
+
+				if err != nil {
+					return err
+				}
 			default:
-				ctx := context.Background()
+				ctx := cmd.Context()
 				mycon, err := grpcconn.GetConnection(ctx, grpcconn.OpsService)
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				client, err := operations.NewClient(ctx, &operations.ClientOptions{Conn: mycon})
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				defer client.Close()
@@ -189,91 +167,44 @@ func OpsGetCmd() *cobra.Command {
 				})
 
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				logger.Info(resp)
+				err = output.Print(output.Input{
+					Headers: []string{"NAME", "DONE"},
+				}, []string{resp.Name, fmt.Sprintf("%v", resp.Done)}, resp)
+
+				if err != nil {
+					return err
+				}
 			}
+
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.Operations)
 	return cmd
 }
 
 func OpsWaitCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "wait <name>",
-		Short: "Wait for a long-running operation to finish",
-		Long:  `Wait for a long-running operation to finish.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			defer func(begin time.Time) {
-				logger.Info("duration:", time.Since(begin))
-			}(time.Now())
-
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		Use:         "wait <name>",
+		Short:       "Wait for a long-running operation to finish",
+		Long:        `Wait for a long-running operation to finish.`,
+		Annotations: map[string]string{LongRunning: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("<name> cannot be empty"))
-				return
+				return cmderr.Usage(fmt.Errorf("<name> cannot be empty"))
 			}
 
-			quit, cancel := context.WithCancel(context.Background())
-			done := make(chan struct{}, 1)
-
-			// Interrupt handler.
-			go func() {
-				sigch := make(chan os.Signal)
-				signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
-				<-sigch
-				cancel()
-			}()
-
-			go func() {
-				for {
-					q := context.WithValue(quit, struct{}{}, nil)
-					op, err := ops.WaitForOperation(q, ops.WaitForOperationInput{
-						Name: args[0],
-					})
-
-					if err != nil {
-						logger.Error(err)
-						done <- struct{}{}
-						return
-					}
-
-					if op != nil {
-						if op.Done {
-							logger.Infof("[%v] done", args[0])
-							done <- struct{}{}
-							return
-						}
-					}
-				}
-			}()
-
-			logger.Infof("wait for [%v], this could take some time...", args[0])
-
-			select {
-			case <-done:
-			case <-quit.Done():
-				logger.Info("interrupted")
-			}
+			return ops.Wait(cmd.Context(), args[0])
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.Operations)
 	return cmd
 }
 
@@ -282,35 +213,20 @@ func OpsDelCmd() *cobra.Command {
 		Use:   "rm <name>",
 		Short: "Delete a long-running operation",
 		Long:  `Delete a long-running operation.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("<name> cannot be empty"))
-				return
+				return cmderr.Usage(fmt.Errorf("<name> cannot be empty"))
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.OpsService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := operations.NewClient(ctx, &operations.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
@@ -319,15 +235,16 @@ func OpsDelCmd() *cobra.Command {
 			})
 
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Infof("deleted: %v", args[0])
+			return nil
 		},
 	}
 
 	cmd.Flags().SortFlags = false
+	cmd.ValidArgsFunction = complete.Args(complete.Operations)
 	return cmd
 }
 
@@ -2,19 +2,23 @@ package cmds
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/alphauslabs/blue-sdk-go/org/v1"
 	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/env"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
@@ -29,22 +33,9 @@ func OrgRegisterCmd() *cobra.Command {
 		Use:   "create <email>",
 		Short: "Create a new organization",
 		Long:  `Create a new organization.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
-				fnerr(fmt.Errorf("<email> cannot be empty"))
-				return
+				return cmderr.Usage(fmt.Errorf("<email> cannot be empty"))
 			}
 
 			if passwd == "" && !cmd.Flag("password").Changed {
@@ -52,68 +43,75 @@ func OrgRegisterCmd() *cobra.Command {
 				fmt.Print("Password: ")
 				pw1, err := term.ReadPassword(int(syscall.Stdin))
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
 				fmt.Print("\nConfirm password: ")
 				pw2, err := term.ReadPassword(int(syscall.Stdin))
 				if err != nil {
-					fnerr(err)
-					return
+					return err
 				}
 
-				switch {
-				case string(pw1) == string(pw2):
-					passwd = string(pw1)
-					fmt.Println("")
-				default:
-					fmt.Println("\nInvalid password.")
-					return
+				fmt.Println("")
+				if string(pw1) != string(pw2) {
+					return cmderr.Usage(errors.New("passwords do not match"))
 				}
+
+				passwd = string(pw1)
 			}
 
 			if desc == "" {
 				fmt.Print("Description: ")
 				fmt.Scanln(&desc)
 				if desc == "" {
-					fnerr(fmt.Errorf("Description is empty."))
-					return
+					return cmderr.Usage(fmt.Errorf("Description is empty."))
 				}
 			}
 
-			hc := &http.Client{Timeout: 60 * time.Second}
-			u := "https://api.alphaus.cloud/m/blue/org/v1"
+			e, err := env.Current()
+			if err != nil {
+				return err
+			}
+
+			base, err := e.Rest()
+			if err != nil {
+				return cmderr.Usage(err)
+			}
+
+			timeout := 60 * time.Second
+			if params.Timeout > 0 {
+				timeout = params.Timeout
+			}
+
+			hc := &http.Client{Timeout: timeout}
+			u := base + "/m/blue/org/v1"
 			entry := make(map[string]interface{})
 			entry["email"] = args[0]
 			entry["password"] = passwd
 			entry["description"] = desc
 			payload, _ := json.Marshal(entry)
-			r, err := http.NewRequest(http.MethodPost, u, bytes.NewBuffer(payload))
+			r, err := http.NewRequestWithContext(cmd.Context(), http.MethodPost, u, bytes.NewBuffer(payload))
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			resp, err := hc.Do(r)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
+			defer resp.Body.Close()
 			if (resp.StatusCode / 100) != 2 {
-				fnerr(fmt.Errorf(resp.Status))
-				return
+				return cmderr.HttpError(resp)
 			}
 
-			defer resp.Body.Close()
 			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			logger.Info(string(body))
+			return nil
 		},
 	}
 
@@ -128,46 +126,39 @@ func OrgGetCmd() *cobra.Command {
 		Use:   "get",
 		Short: "Print information about your organization",
 		Long:  `Print information about your organization.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.OrgService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := org.NewClient(ctx, &org.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			resp, err := client.GetOrg(ctx, &org.GetOrgRequest{})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
+			}
+
+			var md []string
+			for k, v := range resp.Metadata {
+				md = append(md, fmt.Sprintf("%v: %v", k, v))
 			}
 
-			switch {
-			case params.OutFmt == "json":
-				b, _ := json.Marshal(resp)
-				logger.Info(string(b))
-			default:
-				logger.Info(resp)
+			sort.Strings(md)
+			err = output.Print(output.Input{
+				Headers: []string{"NAME", "EMAIL", "METADATA"},
+			}, []string{resp.Name, resp.Email, strings.Join(md, "\n")}, resp)
+
+			if err != nil {
+				return err
 			}
+
+			return nil
 		},
 	}
 
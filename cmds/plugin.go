@@ -0,0 +1,101 @@
+package cmds
+
+import (
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/plugin"
+	"github.com/spf13/cobra"
+)
+
+func PluginListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List plugins on PATH",
+		Long: `List all plugin executables (` + plugin.Prefix + `<name>) found on PATH. Plugins that are shadowed
+by a built-in command, or by another plugin earlier in PATH, are never run.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			builtin := map[string]bool{"help": true, "completion": true}
+			for _, c := range cmd.Root().Commands() {
+				builtin[c.Name()] = true
+				for _, a := range c.Aliases {
+					builtin[a] = true
+				}
+			}
+
+			w, err := output.New(output.Input{
+				Headers: []string{"NAME", "PATH", "STATUS"},
+			})
+
+			if err != nil {
+				return err
+			}
+
+			defer w.Close()
+			first := map[string]string{}
+			for _, p := range plugin.List() {
+				status := "ok"
+				switch {
+				case builtin[p.Name]:
+					status = "shadowed by built-in command"
+				case first[p.Name] != "":
+					status = "shadowed by " + first[p.Name]
+				default:
+					first[p.Name] = p.Path
+				}
+
+				err = w.Append([]string{p.Name, p.Path, status}, map[string]string{
+					"name":   p.Name,
+					"path":   p.Path,
+					"status": status,
+				})
+
+				if err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
+
+func PluginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Subcommand for plugins",
+		Long: `Subcommand for plugins. Any executable on PATH named ` + plugin.Prefix + `<name> can be run as
+'bluectl <name> [args...]'. Global flags before <name> are handled by bluectl; all arguments
+after <name> are passed to the plugin as is. The resolved profile settings are passed to the
+plugin as environment variables:
+
+  BLUECTL                  path to the bluectl executable
+  ALPHAUS_PROFILE          profile name
+  ALPHAUS_ENV              environment name (prod, next, custom)
+  ALPHAUS_AUTH_URL         authentication URL
+  ALPHAUS_ENDPOINT         gRPC endpoint (host:port)
+  ALPHAUS_REST_URL         REST API base URL
+  ALPHAUS_CLIENT_ID        client id
+  ALPHAUS_CLIENT_SECRET    client secret
+  ALPHAUS_OUTFMT           output format (--outfmt)
+  ALPHAUS_OUT              output file (--out), if set
+  ALPHAUS_BARE             --bare (true, false)
+  ALPHAUS_PLAINTEXT        --plaintext (true, false)
+  ALPHAUS_INSECURE         --insecure (true, false)
+  ALPHAUS_CA_CERT          --ca-cert, if set
+  TRACEPARENT, TRACESTATE  trace context, with --otel-endpoint or --otel-file
+
+bluectl reads these variables as the defaults of the matching flags, and the output and
+connection ones (ALPHAUS_OUTFMT to ALPHAUS_CA_CERT) win over the profile, so bluectl commands
+run by a plugin use the same settings as the plugin. The plugin's exit code is returned as is.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Info("see -h for more information")
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.AddCommand(PluginListCmd())
+	return cmd
+}
@@ -0,0 +1,202 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/rest"
+	"github.com/spf13/cobra"
+)
+
+// Request bodies up to this size are buffered, so they can be retried.
+const maxRetryBody = 1 << 20
+
+// statusWriter records the response status, for logs.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// proxyError writes err in the same format as the REST API's errors.
+func proxyError(w http.ResponseWriter, status, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"code":%d,"message":%q}`+"\n", code, msg)
+}
+
+// allowed returns true if p is one of the prefixes, or under one of them on
+// a path segment boundary, i.e. /m/blue allows /m/blue/ops but not /m/bluex.
+// An empty list allows all paths.
+func allowed(p string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, v := range prefixes {
+		v = strings.TrimSuffix(v, "/")
+		if p == v || strings.HasPrefix(p, v+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LongRunning is the cobra command annotation of commands that run until
+// interrupted or until something else finishes, i.e. proxy and ops wait. The
+// profile's timeout doesn't apply to them, only an explicit --timeout.
+const LongRunning = "bluectl/long-running"
+
+func ProxyCmd() *cobra.Command {
+	var (
+		listen string
+		allow  []string
+		quiet  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Run a local authenticated proxy to the REST API",
+		Long: `Run a local HTTP proxy that forwards requests to the REST API of the current environment,
+i.e. https://api.alphaus.cloud for prod, with an access token from the active profile. Tokens are
+cached and refreshed as needed, so other tools can call the API without handling credentials.
+Incoming Authorization and Cookie headers are removed. Use --allow to only forward some paths;
+others get a 403. Runs until interrupted. For example:
+
+  $ bluectl proxy --listen 127.0.0.1:8080 --allow /m/blue/ --allow /m/cost/
+  $ curl http://127.0.0.1:8080/m/blue/iam/v1/whoami
+
+Anyone who can connect to --listen can call the API as you; keep it on localhost.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{LongRunning: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, v := range allow {
+				if !strings.HasPrefix(v, "/") {
+					return cmderr.Usage(fmt.Errorf("invalid --allow %q, must start with /", v))
+				}
+			}
+
+			rc, err := rest.New(0)
+			if err != nil {
+				return err
+			}
+
+			target, err := url.Parse(rc.Base)
+			if err != nil {
+				return err
+			}
+
+			rp := &httputil.ReverseProxy{
+				Rewrite: func(pr *httputil.ProxyRequest) {
+					pr.SetURL(target)
+					pr.Out.Header.Del("Authorization")
+					pr.Out.Header.Del("Cookie")
+				},
+				Transport:     rc,
+				FlushInterval: -1, // for streaming responses
+				ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+					logger.Errorf("%v %v: %v", r.Method, r.URL.Path, err)
+					proxyError(w, http.StatusBadGateway, 14, err.Error()) // codes.Unavailable
+				},
+			}
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+				sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+				defer func() {
+					if !quiet {
+						logger.Infof("%v %v %v %v %v", r.RemoteAddr, r.Method, r.URL.RequestURI(),
+							sw.status, time.Since(start).Round(time.Millisecond))
+					}
+				}()
+
+				// Reject paths like /m/blue/../cost that could get around --allow.
+				p := r.URL.Path
+				if clean := path.Clean(p); clean != strings.TrimSuffix(p, "/") && clean != p {
+					proxyError(sw, http.StatusBadRequest, 3, "invalid path") // codes.InvalidArgument
+					return
+				}
+
+				if !allowed(p, allow) {
+					proxyError(sw, http.StatusForbidden, 7, "path not allowed by bluectl proxy") // codes.PermissionDenied
+					return
+				}
+
+				// Small bodies can be sent again if the token is rejected.
+				if r.ContentLength > 0 && r.ContentLength <= maxRetryBody {
+					b, err := io.ReadAll(r.Body)
+					if err != nil {
+						proxyError(sw, http.StatusBadRequest, 3, err.Error())
+						return
+					}
+
+					r.Body = io.NopCloser(bytes.NewReader(b))
+					r.GetBody = func() (io.ReadCloser, error) {
+						return io.NopCloser(bytes.NewReader(b)), nil
+					}
+				}
+
+				rp.ServeHTTP(sw, r)
+			})
+
+			l, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+
+			srv := &http.Server{Handler: handler, ReadHeaderTimeout: 30 * time.Second}
+			ctx := cmd.Context()
+			go func() {
+				<-ctx.Done()
+				sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				srv.Shutdown(sctx)
+			}()
+
+			logger.Infof("proxying http://%v to %v", l.Addr(), rc.Base)
+			if len(allow) > 0 {
+				logger.Infof("allowed paths: %v", strings.Join(allow, ", "))
+			}
+
+			err = srv.Serve(l)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = ctx.Err()
+			}
+
+			if errors.Is(err, context.Canceled) {
+				return nil // interrupted is how we stop
+			}
+
+			return err
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:8080", "address to listen on, host:port")
+	cmd.Flags().StringSliceVar(&allow, "allow", allow, "path prefix to forward, matched on path segments, i.e. /m/blue, repeatable; default is all paths")
+	cmd.Flags().BoolVar(&quiet, "quiet", quiet, "don't log requests")
+	return cmd
+}
@@ -0,0 +1,299 @@
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/alphauslabs/bluectl/pkg/rest"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var restMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// restItems decodes a REST response body. Streaming methods return a
+// sequence of {"result":{...}} objects, ending with {"error":{...}} on
+// failure; these are unwrapped, and stream is set to true.
+func restItems(r io.Reader, fn func(item json.RawMessage, stream bool) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var v json.RawMessage
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var m map[string]json.RawMessage
+		json.Unmarshal(v, &m)
+		switch {
+		case len(m) == 1 && m["result"] != nil:
+			err = fn(m["result"], true)
+		case len(m) == 1 && m["error"] != nil:
+			var e struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+
+			json.Unmarshal(m["error"], &e)
+			return status.Error(codes.Code(e.Code), e.Message)
+		default:
+			err = fn(v, false)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// nextPage returns u and body updated with the nextPageToken of page, if any.
+func nextPage(page json.RawMessage, u string, body []byte) (string, []byte, bool) {
+	var p struct {
+		NextPageToken string `json:"nextPageToken"`
+	}
+
+	json.Unmarshal(page, &p)
+	if p.NextPageToken == "" {
+		return u, body, false
+	}
+
+	if len(body) > 0 {
+		var m map[string]any
+		if json.Unmarshal(body, &m) != nil {
+			return u, body, false
+		}
+
+		m["pageToken"] = p.NextPageToken
+		b, _ := json.Marshal(m)
+		return u, b, true
+	}
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		return u, body, false
+	}
+
+	q := pu.Query()
+	q.Set("pageToken", p.NextPageToken)
+	pu.RawQuery = q.Encode()
+	return pu.String(), body, true
+}
+
+// restRaw writes a non-JSON response body to stdout, or to --out.
+func restRaw(r io.Reader) error {
+	if params.OutFile == "" {
+		_, err := io.Copy(os.Stdout, r)
+		return err
+	}
+
+	f, err := os.Create(params.OutFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func RestCmd() *cobra.Command {
+	var (
+		data     string
+		headers  []string
+		paginate bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rest <" + strings.Join(restMethods, "|") + "> <path>",
+		Short: "Make an authenticated REST API call",
+		Long: `Make an authenticated call to the REST API of the current environment, i.e. https://api.alphaus.cloud
+for prod. <path> is relative to the base URL, as in https://labs.alphaus.cloud/blueapidocs/. The request
+body is set by --data, in the same format as --raw-input. JSON responses are printed in JSON by default,
+or in the format set by --outfmt (json, jsonl, yaml); other responses are written as is. Streamed
+responses print one item per message. With --paginate, calls are repeated with the response's
+nextPageToken until the last page, printing one item per page; streamed responses can't be
+paginated. For example:
+
+  $ bluectl rest GET /m/blue/ops/v1/<name>
+  $ bluectl rest POST /m/cost/v1/aws/costs:read --data @req.yaml --outfmt jsonl`,
+		Args: cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			return restMethods, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			method := strings.ToUpper(args[0])
+			if !slices.Contains(restMethods, method) {
+				return cmderr.Usage(fmt.Errorf("invalid method %v, valid values: %v",
+					args[0], strings.Join(restMethods, ", ")))
+			}
+
+			var body []byte
+			if data != "" {
+				b, err := rawinput.Read(data, params.RawInputVars)
+				if err != nil {
+					return cmderr.Usage(fmt.Errorf("invalid --data: %w", err))
+				}
+
+				body = b
+			}
+
+			if params.OutFmt == "" {
+				params.OutFmt = output.FormatJson
+				if params.ErrorFormat == "" {
+					params.ErrorFormat = cmderr.FormatText // only json if asked
+				}
+			}
+
+			switch output.Format() {
+			case output.FormatJson, output.FormatJsonl, output.FormatYaml:
+			default:
+				return cmderr.Usage(fmt.Errorf("unsupported output format: %v, valid values: json, jsonl, yaml", params.OutFmt))
+			}
+
+			hdrs := http.Header{}
+			for _, h := range headers {
+				k, v, ok := strings.Cut(h, ":")
+				if !ok {
+					return cmderr.Usage(fmt.Errorf("invalid header %q, expected key:value", h))
+				}
+
+				hdrs.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+			}
+
+			rc, err := rest.New(0)
+			if err != nil {
+				return err
+			}
+
+			u, err := rc.Url(args[1])
+			if err != nil {
+				return cmderr.Usage(err)
+			}
+
+			ctx := cmd.Context()
+			var w *output.Writer
+			defer func() {
+				if w != nil {
+					w.Close()
+				}
+			}()
+
+			for {
+				var rd io.Reader
+				if body != nil {
+					rd = bytes.NewReader(body)
+				}
+
+				r, err := http.NewRequestWithContext(ctx, method, u, rd)
+				if err != nil {
+					return err
+				}
+
+				r.Header = hdrs.Clone()
+				r.Header.Set("Accept", "application/json")
+				if body != nil {
+					r.Header.Set("Content-Type", "application/json")
+				}
+
+				resp, err := rc.Do(r)
+				if err != nil {
+					return err
+				}
+
+				if (resp.StatusCode / 100) != 2 {
+					err = cmderr.HttpError(resp)
+					resp.Body.Close()
+					return err
+				}
+
+				ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+				if w == nil && ct != "application/json" {
+					err = restRaw(resp.Body)
+					resp.Body.Close()
+					return err
+				}
+
+				// Only unary responses are pages; streams have no envelope with a
+				// nextPageToken, just items that might have fields of the same name.
+				var last json.RawMessage
+				var n int
+				err = restItems(resp.Body, func(item json.RawMessage, stream bool) error {
+					n++
+					if paginate && (stream || n > 1) {
+						return cmderr.Usage(fmt.Errorf("--paginate is not supported for streamed responses"))
+					}
+
+					if w == nil {
+						var err error
+						w, err = output.New(output.Input{
+							Keys:   []string{"item"}, // unused, items are marshaled as is
+							Single: !stream && !paginate,
+						})
+
+						if err != nil {
+							return err
+						}
+					}
+
+					last = item
+					return w.Append(nil, item)
+				})
+
+				resp.Body.Close()
+				if err != nil {
+					return err
+				}
+
+				var more bool
+				if paginate && n == 1 {
+					u, body, more = nextPage(last, u, body)
+				}
+
+				if !more {
+					if w == nil {
+						return nil
+					}
+
+					return w.Close()
+				}
+			}
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringVar(&data, "data", data, "request body in JSON or YAML, @file, or - for stdin; same as --raw-input")
+	cmd.Flags().StringArrayVar(&params.RawInputVars, "var", nil, "key=value: template variable for --data, i.e. {{.key}}, repeatable; the input is a template only if set, where {{\"{{\"}} is a literal {{")
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", headers, "key:value: additional request header, repeatable")
+	cmd.Flags().BoolVar(&paginate, "paginate", paginate, "follow nextPageToken until the last page")
+	return cmd
+}
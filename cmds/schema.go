@@ -0,0 +1,103 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"gopkg.in/yaml.v2"
+)
+
+func SchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema [command...]",
+		Short: "Print the --raw-input skeleton of a command",
+		Long: `Print the JSON skeleton of the request message that a command accepts in --raw-input, with all
+fields set to zero values. Use --outfmt yaml for YAML. Without arguments, list the commands that
+support --raw-input. For example:
+
+  $ bluectl schema cost aws usage get > req.json
+  $ bluectl cost aws usage get --raw-input @req.json`,
+		PersistentPreRun: noProfilePreRun,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				w, err := output.New(output.Input{
+					Headers: []string{"COMMAND", "REQUEST"},
+				})
+
+				if err != nil {
+					return err
+				}
+
+				defer w.Close()
+				var walk func(c *cobra.Command) error
+				walk = func(c *cobra.Command) error {
+					if name, ok := c.Annotations[rawinput.Annotation]; ok {
+						path := strings.TrimPrefix(c.CommandPath(), c.Root().Name()+" ")
+						err := w.Append([]string{path, name})
+						if err != nil {
+							return err
+						}
+					}
+
+					for _, sub := range c.Commands() {
+						err := walk(sub)
+						if err != nil {
+							return err
+						}
+					}
+
+					return nil
+				}
+
+				err = walk(cmd.Root())
+				if err != nil {
+					return err
+				}
+
+				return w.Close()
+			}
+
+			target, rest, err := cmd.Root().Find(args)
+			if err != nil || len(rest) > 0 || target == cmd.Root() {
+				return cmderr.Usage(fmt.Errorf("unknown command %q", strings.Join(args, " ")))
+			}
+
+			name, ok := target.Annotations[rawinput.Annotation]
+			if !ok {
+				return cmderr.Usage(fmt.Errorf("'%v' doesn't support --raw-input", target.CommandPath()))
+			}
+
+			mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+			if err != nil {
+				return err
+			}
+
+			b := rawinput.Skeleton(mt.Descriptor())
+			if output.Format() == output.FormatYaml {
+				var ms yaml.MapSlice
+				err = yaml.Unmarshal(b, &ms)
+				if err != nil {
+					return err
+				}
+
+				b, err = yaml.Marshal(ms)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = os.Stdout.Write(b)
+			return err
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	return cmd
+}
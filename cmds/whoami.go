@@ -1,13 +1,13 @@
 package cmds
 
 import (
-	"context"
-	"encoding/json"
-	"os"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/alphauslabs/blue-sdk-go/iam/v1"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
-	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/output"
 	"github.com/spf13/cobra"
 )
 
@@ -16,41 +16,39 @@ func WhoAmICmd() *cobra.Command {
 		Use:   "whoami",
 		Short: "Get my information as a user",
 		Long:  `Get my information as a user.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			var ret int
-			defer func(r *int) {
-				if *r != 0 {
-					os.Exit(*r)
-				}
-			}(&ret)
-
-			fnerr := func(e error) {
-				logger.Error(e)
-				ret = 1
-			}
-
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
 			}
 
 			defer client.Close()
 			resp, err := client.WhoAmI(ctx, &iam.WhoAmIRequest{})
 			if err != nil {
-				fnerr(err)
-				return
+				return err
+			}
+
+			var md []string
+			for k, v := range resp.Metadata {
+				md = append(md, fmt.Sprintf("%v: %v", k, v))
+			}
+
+			sort.Strings(md)
+			err = output.Print(output.Input{
+				Headers: []string{"ID", "PARENT", "METADATA"},
+			}, []string{resp.Id, resp.Parent, strings.Join(md, "\n")}, resp)
+
+			if err != nil {
+				return err
 			}
 
-			b, _ := json.Marshal(resp)
-			logger.Info(string(b))
+			return nil
 		},
 	}
 
@@ -1,19 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/alphauslabs/blue-sdk-go/api"
 	"github.com/alphauslabs/bluectl/cmds"
 	"github.com/alphauslabs/bluectl/cmds/cost"
 	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cache"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/config"
+	"github.com/alphauslabs/bluectl/pkg/env"
+	"github.com/alphauslabs/bluectl/pkg/grpcconn"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"github.com/alphauslabs/bluectl/pkg/plugin"
+	"github.com/alphauslabs/bluectl/pkg/telemetry"
 	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
 	"github.com/fatih/color"
-	tomlv2 "github.com/pelletier/go-toml/v2"
 	"github.com/spf13/cobra"
 )
 
@@ -22,12 +34,135 @@ var (
 	commit  = "none"
 	date    = "unknown"
 
+	// Cancels the --timeout deadline, if set.
+	cancelTimeout = func() {}
+
 	bold = color.New(color.Bold).SprintFunc()
 	year = func() string {
 		return fmt.Sprintf("%v", time.Now().Year())
 	}
 
-	rootCmd = &cobra.Command{
+	// Our root command, see newRootCmd.
+	rootCmd *cobra.Command
+)
+
+// loadProfile applies the settings of the selected profile from our config
+// file. Flags that are explicitly set always take precedence.
+func loadProfile(cmd *cobra.Command) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	name, explicit := cfg.ProfileName(params.AuthProfile)
+	p, ok := cfg.Profile(name)
+	if !ok {
+		if explicit {
+			return fmt.Errorf("[%v] not found in %v", name, cfg.Path())
+		}
+
+		return nil
+	}
+
+	// Output and connection settings passed to plugins win over the profile,
+	// so bluectl commands run by plugins use the same settings as the plugin.
+	pluginEnv := map[string]string{
+		"outfmt":    "ALPHAUS_OUTFMT",
+		"bare":      "ALPHAUS_BARE",
+		"plaintext": "ALPHAUS_PLAINTEXT",
+		"insecure":  "ALPHAUS_INSECURE",
+		"ca-cert":   "ALPHAUS_CA_CERT",
+	}
+
+	params.AuthProfile = name
+	set := func(key string, fn func(v string) error) error {
+		v, ok := p[key]
+		if !ok || cmd.Flags().Changed(key) {
+			return nil
+		}
+
+		if k, isPluginEnv := pluginEnv[key]; isPluginEnv && os.Getenv(k) != "" {
+			return nil
+		}
+
+		if _, err := config.Parse(key, v); err != nil {
+			return fmt.Errorf("[%v] %w", name, err)
+		}
+
+		return fn(v)
+	}
+
+	setstr := func(dst *string) func(string) error {
+		return func(v string) error {
+			*dst = v
+			return nil
+		}
+	}
+
+	setbool := func(dst *bool) func(string) error {
+		return func(v string) error {
+			*dst, err = strconv.ParseBool(v)
+			return err
+		}
+	}
+
+	for _, f := range []struct {
+		key string
+		fn  func(string) error
+	}{
+		{"client-id", setstr(&params.ClientId)},
+		{"client-secret", setstr(&params.ClientSecret)},
+		{"auth-url", setstr(&params.AuthUrl)},
+		{"env", setstr(&params.Env)},
+		{"endpoint", setstr(&params.Endpoint)},
+		{"rest-url", setstr(&params.RestUrl)},
+		{"outfmt", setstr(&params.OutFmt)},
+		{"bare", setbool(&params.CleanOut)},
+		{"plaintext", setbool(&params.Plaintext)},
+		{"insecure", setbool(&params.Insecure)},
+		{"ca-cert", setstr(&params.CaCert)},
+		{"timeout", func(v string) error {
+			params.Timeout, err = time.ParseDuration(v)
+			return err
+		}},
+	} {
+		if err := set(f.key, f.fn); err != nil {
+			return err
+		}
+	}
+
+	// Other client secret sources; an explicit --client-secret still wins.
+	if !cmd.Flags().Changed("client-secret") {
+		var n int
+		for _, k := range config.SecretKeys {
+			if _, ok := p[k]; ok {
+				n++
+			}
+		}
+
+		if n > 1 {
+			return fmt.Errorf("[%v] only one of %v is allowed", name, strings.Join(config.SecretKeys, ", "))
+		}
+
+		switch {
+		case p["client-secret-file"] != "":
+			params.ClientSecret, err = config.ReadSecretFile(p["client-secret-file"])
+			if err != nil {
+				return fmt.Errorf("[%v] %w", name, err)
+			}
+		case p["credential-process"] != "":
+			// Run by auth.Source only when we need a new token.
+			params.CredProcess = p["credential-process"]
+			params.ClientIdFlag = cmd.Flags().Changed("client-id")
+		}
+	}
+
+	return nil
+}
+
+// newRootCmd returns our root command, with all flags set to their defaults.
+func newRootCmd() *cobra.Command {
+	root := &cobra.Command{
 		Use:   "bluectl",
 		Short: bold("bluectl") + " - Command line interface for Alphaus services",
 		Long: bold("bluectl") + ` - Command line interface for Alphaus services.
@@ -36,71 +171,81 @@ Copyright (c) 2021-` + year() + ` Alphaus Cloud, Inc. All rights reserved.
 The general form is ` + bold("bluectl <resource[ subresource...]> <action> [flags]") + `. Most commands support
 the ` + bold("--raw-input") + ` flag to be always in sync with the current feature set of the API in case the
 built-in flags don't support all the possible input combinations yet. For beta APIs, we recommend
-you to use the ` + bold("--raw-input") + ` flag. See https://labs.alphaus.cloud/blueapidocs/ for the latest API reference.`,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+you to use the ` + bold("--raw-input") + ` flag. See https://labs.alphaus.cloud/blueapidocs/ for the latest API reference.
+
+` + cmderr.ExitCodesHelp,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmderr.Running()
 			params.Version = version
-			if params.CleanOut {
-				logger.SetPrefix(logger.PrefixNone)
+			if params.Record != "" && params.Replay != "" {
+				return cmderr.Usage(fmt.Errorf("--record and --replay are mutually exclusive"))
 			}
 
-			home, _ := os.UserHomeDir()
-			cfgfile := filepath.Join(home, ".config", "alphaus", "config.toml")
-			_, err := os.Stat(cfgfile)
-			if err == nil {
-				if params.AuthProfile == "" {
-					params.AuthProfile = "default"
-				}
+			err := loadProfile(cmd)
+			if err != nil {
+				return err
 			}
 
-			if params.AuthProfile != "" {
-				b, err := os.ReadFile(cfgfile)
-				if err != nil {
-					logger.Error(err)
-					os.Exit(1)
-				}
-
-				var cfg map[string]map[string]string
-				err = tomlv2.Unmarshal(b, &cfg)
-				if err != nil {
-					logger.Error(err)
-					os.Exit(1)
-				}
-
-				if v, ok := cfg[params.AuthProfile]; ok {
-					if _, ok = v["client-id"]; ok {
-						params.ClientId = v["client-id"]
-					}
-
-					if _, ok = v["client-secret"]; ok {
-						params.ClientSecret = v["client-secret"]
-					}
-
-					if _, ok = v["auth-url"]; ok {
-						params.AuthUrl = v["auth-url"]
-					}
-				} else {
-					logger.Errorf("[%v] not found in %v", params.AuthProfile, cfgfile)
-					os.Exit(1)
-				}
+			if _, err := env.Current(); err != nil {
+				return err
 			}
+
+			err = telemetry.StartCommand(cmd)
+			if err != nil {
+				return err
+			}
+
+			// A profile's timeout is meant for request/response commands;
+			// long-running ones only stop early with an explicit --timeout.
+			_, long := cmd.Annotations[cmds.LongRunning]
+			if params.Timeout > 0 && (!long || cmd.Flags().Changed("timeout")) {
+				ctx, cancel := context.WithTimeout(cmd.Context(), params.Timeout)
+				cmd.SetContext(ctx)
+				cancelTimeout = cancel
+			}
+
+			if params.CleanOut {
+				logger.SetPrefix(logger.PrefixNone)
+			}
+
+			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			logger.Info("see -h for more information")
 		},
 	}
-)
-
-func init() {
-	rootCmd.Flags().SortFlags = false
-	rootCmd.PersistentFlags().SortFlags = false
-	rootCmd.PersistentFlags().StringVar(&params.AuthProfile, "profile", params.AuthProfile, "profile name in ~/.config/alphaus/config.toml, default is [default]")
-	rootCmd.PersistentFlags().StringVar(&params.AuthUrl, "auth-url", os.Getenv("ALPHAUS_AUTH_URL"), "authentication URL, defaults to $ALPHAUS_AUTH_URL if set")
-	rootCmd.PersistentFlags().StringVar(&params.ClientId, "client-id", os.Getenv("ALPHAUS_CLIENT_ID"), "your client id, defaults to $ALPHAUS_CLIENT_ID")
-	rootCmd.PersistentFlags().StringVar(&params.ClientSecret, "client-secret", os.Getenv("ALPHAUS_CLIENT_SECRET"), "your client secret, defaults to $ALPHAUS_CLIENT_SECRET")
-	rootCmd.PersistentFlags().StringVar(&params.OutFile, "out", params.OutFile, "output file, if the command supports writing to file")
-	rootCmd.PersistentFlags().StringVar(&params.OutFmt, "outfmt", "csv", "output format: json, csv, valid if --out is set")
-	rootCmd.PersistentFlags().BoolVar(&params.CleanOut, "bare", params.CleanOut, "if true, set console output to barebones, easier for scripting")
-	rootCmd.AddCommand(
+	root.Flags().SortFlags = false
+	root.PersistentFlags().SortFlags = false
+	root.PersistentFlags().StringVar(&params.AuthProfile, "profile", params.AuthProfile, "profile name in ~/.config/alphaus/config.toml, defaults to $ALPHAUS_PROFILE, then current-profile, then [default]")
+	root.PersistentFlags().StringVar(&params.Env, "env", os.Getenv("ALPHAUS_ENV"), "environment: prod, next, custom; default is the profile's env if set, then $ALPHAUS_ENV, then prod")
+	root.PersistentFlags().StringVar(&params.Endpoint, "endpoint", os.Getenv("ALPHAUS_ENDPOINT"), "gRPC endpoint (host:port) to use instead of the environment's, defaults to $ALPHAUS_ENDPOINT if set")
+	root.PersistentFlags().StringVar(&params.RestUrl, "rest-url", os.Getenv("ALPHAUS_REST_URL"), "REST API base URL to use instead of the environment's, defaults to $ALPHAUS_REST_URL if set")
+	root.PersistentFlags().BoolVar(&params.Plaintext, "plaintext", envBool("ALPHAUS_PLAINTEXT"), "if true, connect to --endpoint without TLS, i.e. local test servers; defaults to $ALPHAUS_PLAINTEXT")
+	root.PersistentFlags().BoolVar(&params.Insecure, "insecure", envBool("ALPHAUS_INSECURE"), "if true, skip TLS certificate verification; defaults to $ALPHAUS_INSECURE")
+	root.PersistentFlags().StringVar(&params.CaCert, "ca-cert", os.Getenv("ALPHAUS_CA_CERT"), "PEM file of CA certificates to trust, in addition to the system's; defaults to $ALPHAUS_CA_CERT if set")
+	root.PersistentFlags().StringVar(&params.AuthUrl, "auth-url", os.Getenv("ALPHAUS_AUTH_URL"), "authentication URL, defaults to $ALPHAUS_AUTH_URL if set")
+	root.PersistentFlags().StringVar(&params.ClientId, "client-id", os.Getenv("ALPHAUS_CLIENT_ID"), "your client id, defaults to $ALPHAUS_CLIENT_ID")
+	root.PersistentFlags().StringVar(&params.ClientSecret, "client-secret", os.Getenv("ALPHAUS_CLIENT_SECRET"), "your client secret, defaults to $ALPHAUS_CLIENT_SECRET")
+	root.PersistentFlags().DurationVar(&params.Timeout, "timeout", params.Timeout, "max duration of the command (i.e. 30s, 5m), including waits; no limit if 0; a profile timeout doesn't apply to proxy and ops wait")
+	root.PersistentFlags().IntVar(&params.Retries, "retries", 5, "max consecutive retries of cost streams on transient errors (unavailable, rate limited); 0 to disable")
+	root.PersistentFlags().BoolVar(&params.NoTokenCache, "no-token-cache", params.NoTokenCache, "if true, don't use the access token cache in ~/.cache/alphaus/")
+	root.PersistentFlags().StringVar(&params.OutFile, "out", os.Getenv("ALPHAUS_OUT"), "output file, if the command supports writing to file; defaults to $ALPHAUS_OUT if set")
+	root.PersistentFlags().BoolVar(&params.RemovePartial, "rm-partial", params.RemovePartial, "if true, remove the --out file when the command fails or is interrupted")
+	root.PersistentFlags().StringVar(&params.OutFmt, "outfmt", os.Getenv("ALPHAUS_OUTFMT"), "output format: table, csv, json, jsonl, yaml; default is $ALPHAUS_OUTFMT if set, then the profile's outfmt, then table, or csv if --out is set; csv headers use the same keys as json, i.e. billingGroupId")
+	root.PersistentFlags().StringVar(&params.ErrorFormat, "error-format", params.ErrorFormat, "error output format: text, json; default is json if --outfmt is json or jsonl, otherwise text")
+	root.PersistentFlags().BoolVar(&params.Verbose, "verbose", params.Verbose, "if true, log API calls (method, status, latency) to stderr")
+	root.PersistentFlags().BoolVar(&params.Trace, "trace", params.Trace, "if true, same as --verbose, plus request/response payloads and metadata; secrets are redacted")
+	root.PersistentFlags().BoolVar(&params.Cache, "cache", params.Cache, "if true, use the local cache for cost queries (usage, adjustments, tags, attributes) of closed months; see 'bluectl cache'")
+	root.PersistentFlags().DurationVar(&params.CacheTtl, "cache-ttl", cache.DefaultTtl, "how long cached results are valid, with --cache")
+	root.PersistentFlags().StringVar(&params.Record, "record", params.Record, "record all API calls (requests and responses) to this cassette file, for --replay")
+	root.PersistentFlags().StringVar(&params.Replay, "replay", params.Replay, "serve API calls from this cassette file (see --record) instead of the network")
+	root.PersistentFlags().StringVar(&params.OtelEndpoint, "otel-endpoint", os.Getenv("ALPHAUS_OTEL_ENDPOINT"), "OpenTelemetry OTLP/gRPC endpoint (host:port, or http://host:port without TLS) to export traces to, defaults to $ALPHAUS_OTEL_ENDPOINT")
+	root.PersistentFlags().StringVar(&params.OtelFile, "otel-file", os.Getenv("ALPHAUS_OTEL_FILE"), "file to append OpenTelemetry traces to, as JSON, instead of --otel-endpoint; defaults to $ALPHAUS_OTEL_FILE")
+	root.PersistentFlags().BoolVar(&params.CleanOut, "bare", envBool("ALPHAUS_BARE"), "if true, set console output to barebones, easier for scripting; defaults to $ALPHAUS_BARE")
+	root.AddCommand(
+		cmds.ConfigCmd(),
+		cmds.AliasCmd(),
+		cmds.CacheCmd(),
 		cmds.AccessTokenCmd(),
 		cmds.WhoAmICmd(),
 		cmds.OrgCmd(),
@@ -113,12 +258,219 @@ func init() {
 		cmds.BillingCmd(),
 		cmds.NotificationCmd(),
 		cmds.OpsCmd(),
+		cmds.ApplyCmd(),
+		cmds.DiffCmd(),
+		cmds.ExportCmd(),
+		cmds.SchemaCmd(),
+		cmds.ApiCmd(),
+		cmds.RestCmd(),
+		cmds.ProxyCmd(),
+		cmds.PluginCmd(),
 		cmds.VersionCmd(),
 	)
+
+	return root
+}
+
+// envBool returns the boolean value of the environment variable key, false
+// if not set or invalid.
+func envBool(key string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(key))
+	return v
+}
+
+// errorFormatFromArgs sets params.ErrorFormat from raw args, for errors that
+// happen before our flags are parsed.
+func errorFormatFromArgs(args []string) {
+	for i, a := range args {
+		switch {
+		case a == "--":
+			return
+		case a == "--error-format" && i+1 < len(args):
+			params.ErrorFormat = args[i+1]
+		case strings.HasPrefix(a, "--error-format="):
+			params.ErrorFormat = strings.TrimPrefix(a, "--error-format=")
+		}
+	}
+}
+
+// builtin returns true if name is one of our commands. Aliases and plugins
+// can't override them.
+func builtin(name string) bool {
+	switch {
+	case name == "help", name == "completion", strings.HasPrefix(name, "__"):
+		return true
+	}
+
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitArgs returns the first non-flag argument of args (the command name),
+// the global flags before it, and the arguments after it. name is empty if
+// there's none, or if help is requested.
+func splitArgs(args []string) (flags []string, name string, rest []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--", a == "-h", a == "--help":
+			return nil, "", nil
+		case strings.HasPrefix(a, "-"):
+			flags = append(flags, a)
+			if strings.Contains(a, "=") {
+				continue
+			}
+
+			f := rootCmd.PersistentFlags().Lookup(strings.TrimLeft(a, "-"))
+			if f != nil && f.NoOptDefVal == "" && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		default:
+			return flags, a, args[i+1:]
+		}
+	}
+
+	return nil, "", nil
+}
+
+// expandAlias returns args with the alias from our config file, if any,
+// expanded. Aliases are expanded once; they can refer to plugins, but not
+// to other aliases.
+func expandAlias(args []string) ([]string, error) {
+	flags, name, rest := splitArgs(args)
+	if name == "" || builtin(name) {
+		return args, nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return args, nil // reported later, when loading the profile
+	}
+
+	command, ok := cfg.Alias(name)
+	if !ok {
+		return args, nil
+	}
+
+	words, err := config.Expand(command, rest)
+	if err != nil {
+		return args, cmderr.Usage(fmt.Errorf("alias %v: %w", name, err))
+	}
+
+	return append(flags, words...), nil
+}
+
+// pluginArgs returns the plugin to run for args, if the command is not one of
+// ours: the first non-flag argument is the plugin name, flags before it are
+// our global flags, and everything after it is passed to the plugin as is.
+func pluginArgs(args []string) (flags []string, path string, pargs []string, ok bool) {
+	flags, name, pargs := splitArgs(args)
+	if name == "" || builtin(name) {
+		return nil, "", nil, false
+	}
+
+	path, err := plugin.Find(name)
+	if err != nil {
+		return nil, "", nil, false
+	}
+
+	return flags, path, pargs, true
+}
+
+// runPlugin runs a plugin with our global flags and profile resolved the
+// same way as our own commands.
+func runPlugin(ctx context.Context, flags []string, path string, args []string) error {
+	rootCmd.SetContext(ctx)
+	err := rootCmd.ParseFlags(flags)
+	if err != nil {
+		return cmderr.Usage(err)
+	}
+
+	err = rootCmd.PersistentPreRunE(rootCmd, args)
+	if err != nil {
+		return err
+	}
+
+	return plugin.Run(rootCmd.Context(), path, args)
 }
 
 func main() {
+	// Commands are canceled on SIGINT/SIGTERM; a second signal kills us.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	os.Exit(run(ctx, os.Args[1:]))
+}
+
+// run runs the command in args and returns our exit code. It starts from a
+// new root command and resets our global state, so it can be called more than
+// once in the same process, i.e. in tests.
+func run(ctx context.Context, args []string) int {
+	params.Reset()
+	cmderr.Reset()
+	grpcconn.ResetCassettes()
+	cancelTimeout = func() {}
 	cobra.EnableCommandSorting = false
 	log.SetOutput(os.Stdout)
-	rootCmd.Execute()
+	rootCmd = newRootCmd()
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+
+	cmd := rootCmd
+	args, err := expandAlias(args)
+	if err == nil {
+		switch flags, path, pargs, ok := pluginArgs(args); {
+		case ok:
+			err = runPlugin(ctx, flags, path, pargs)
+		default:
+			rootCmd.SetArgs(args)
+			cmd, err = rootCmd.ExecuteContextC(ctx)
+		}
+	}
+
+	if e := grpcconn.FlushRecording(); e != nil && err == nil {
+		err = e
+	}
+
+	cancelTimeout()
+	if err == nil {
+		telemetry.EndCommand(cmd.Context(), nil, cmderr.ExitOK)
+		return cmderr.ExitOK
+	}
+
+	if ctx.Err() != nil {
+		err = cmderr.ErrInterrupted
+	}
+
+	if params.RemovePartial {
+		output.RemovePartial()
+	}
+
+	if params.ErrorFormat == "" {
+		// Flag parsing might have failed before --error-format.
+		errorFormatFromArgs(args)
+	}
+
+	code := cmderr.Code(err)
+	switch {
+	case errors.Is(err, plugin.ErrExit), errors.Is(err, cmderr.ErrSilent):
+		// The plugin, or the command, has reported its own error.
+	default:
+		code = cmderr.Handle(err, cmd.CommandPath())
+		if code == cmderr.ExitUsage && !cmderr.IsJson() {
+			logger.Infof("run '%v --help' for usage", cmd.CommandPath())
+		}
+	}
+
+	telemetry.EndCommand(cmd.Context(), err, code)
+	return code
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphauslabs/blue-internal-go/protos"
+	awscost "github.com/alphauslabs/blue-sdk-go/api/aws"
+	"github.com/alphauslabs/blue-sdk-go/billing/v1"
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/blue-sdk-go/operations/v1"
+	"github.com/alphauslabs/bluectl/pkg/bluetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func harness(t *testing.T) *bluetest.Harness {
+	t.Helper()
+	h, err := bluetest.NewHarness(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(h.Close)
+	return h
+}
+
+func bluectl(t *testing.T, h *bluetest.Harness, args ...string) *bluetest.Result {
+	t.Helper()
+	res, err := h.Run(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestUsageGet(t *testing.T) {
+	h := harness(t)
+	h.Fake.Reply(cost.Cost_ReadCosts_FullMethodName,
+		&cost.CostItem{Aws: &awscost.Cost{Date: "20260801", Usage: 1, Cost: 1.5, BaseCurrency: "USD", AmortizedCost: 1.25}},
+		&cost.CostItem{Aws: &awscost.Cost{Date: "20260802", Usage: 2, Cost: 0.25, BaseCurrency: "USD"}},
+	)
+
+	args := []string{"cost", "aws", "usage", "get", "--id", "000000000001", "--start", "20260801", "--end", "20260831"}
+	res := bluectl(t, h, append(args, "--outfmt", "csv")...)
+	// csv has all the fields, not only the table columns.
+	want := "groupId,account,date,productCode,serviceCode,region,zone,usageType,instanceType,operation,invoiceId,description,resourceId,tags,costCategories," +
+		"usageAmount,cost,baseCurrency,exchangeRate,targetCost,targetCurrency,effectiveCost,targetEffectiveCost,amortizedCost,targetAmortizedCost\n" +
+		",,20260801,,,,,,,,,,,,,1.000000000,1.500000000,USD,0.000000000,0.000000000,,0.000000000,0.000000000,1.250000000,0.000000000\n" +
+		",,20260802,,,,,,,,,,,,,2.000000000,0.250000000,USD,0.000000000,0.000000000,,0.000000000,0.000000000,0.000000000,0.000000000\n"
+
+	if res.ExitCode != 0 || res.Stdout != want {
+		t.Fatalf("exit code %v, stdout:\n%s\nwant:\n%s\nstderr: %s", res.ExitCode, res.Stdout, want, res.Stderr)
+	}
+
+	calls := h.Fake.Calls(cost.Cost_ReadCosts_FullMethodName)
+	wantReq := &cost.ReadCostsRequest{
+		Vendor:     "aws",
+		AccountId:  "000000000001",
+		StartTime:  "20260801",
+		EndTime:    "20260831",
+		AwsOptions: &cost.ReadCostsRequestAwsOptions{},
+	}
+
+	if len(calls) != 1 || !proto.Equal(calls[0].Request, wantReq) {
+		t.Errorf("got calls %v, want one with %v", calls, wantReq)
+	}
+
+	// So does json.
+	res = bluectl(t, h, append(args, "--outfmt", "jsonl")...)
+	if !strings.Contains(res.Stdout, `"amortizedCost":1.25`) || !strings.Contains(res.Stdout, `"targetCurrency":""`) {
+		t.Errorf("jsonl output is missing fields:\n%s", res.Stdout)
+	}
+
+	// Table output has the totals.
+	res = bluectl(t, h, args...)
+	lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	if got := strings.Fields(lines[len(lines)-1]); strings.Join(got, " ") != "TOTAL 3.0000000000 1.7500000000" {
+		t.Errorf("got total line %q, stdout:\n%s", got, res.Stdout)
+	}
+
+	// --id is required.
+	res = bluectl(t, h, "cost", "aws", "usage", "get")
+	if res.ExitCode != 2 {
+		t.Errorf("got exit code %v, want 2; stderr: %s", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestBillingAwsDrift(t *testing.T) {
+	h := harness(t)
+	h.Fake.Reply(billing.Billing_ListUsageCostsDrift_FullMethodName,
+		&billing.UsageCostsDrift{BillingInternalId: "in1", BillingGroupId: "g1", Account: "a1", Snapshot: 10, Current: 12, Diff: 2},
+		&billing.UsageCostsDrift{BillingInternalId: "in1", BillingGroupId: "g1", Account: "a2", Snapshot: 5, Current: 4, Diff: -1},
+	)
+
+	res := bluectl(t, h, "billing", "aws", "drift", "202608", "in1", "--outfmt", "jsonl")
+	want := `{"billingInternalId":"in1","billingGroupId":"g1","account":"a1","snapshot":10,"current":12,"diff":2}` + "\n" +
+		`{"billingInternalId":"in1","billingGroupId":"g1","account":"a2","snapshot":5,"current":4,"diff":-1}` + "\n"
+
+	if res.ExitCode != 0 || res.Stdout != want {
+		t.Fatalf("exit code %v, stdout:\n%s\nwant:\n%s\nstderr: %s", res.ExitCode, res.Stdout, want, res.Stderr)
+	}
+
+	calls := h.Fake.Calls(billing.Billing_ListUsageCostsDrift_FullMethodName)
+	wantReq := &billing.ListUsageCostsDriftRequest{Vendor: "aws", BillingInternalId: "in1", Month: "202608"}
+	if len(calls) != 1 || !proto.Equal(calls[0].Request, wantReq) {
+		t.Errorf("got calls %v, want one with %v", calls, wantReq)
+	}
+
+	// Diffs are absolute in tables, including the total.
+	res = bluectl(t, h, "billing", "aws", "drift", "202608")
+	lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %v lines, want 4:\n%s", len(lines), res.Stdout)
+	}
+
+	for i, want := range []string{
+		"in1 g1 a2 202608 5.000000000 4.000000000 1.000000000",
+		"TOTAL 15.000000000 16.000000000 3.000000000",
+	} {
+		if got := strings.Join(strings.Fields(lines[i+2]), " "); got != want {
+			t.Errorf("line %v: got %q, want %q", i+2, got, want)
+		}
+	}
+
+	res = bluectl(t, h, "billing", "aws", "drift", "2026-08")
+	if res.ExitCode == 0 {
+		t.Errorf("invalid month: got exit code 0")
+	}
+}
+
+func TestOpsWait(t *testing.T) {
+	h := harness(t)
+	var n int
+	h.Fake.Unary(operations.Operations_WaitOperation_FullMethodName, func(req proto.Message) (proto.Message, error) {
+		n++
+		name := req.(*operations.WaitOperationRequest).Name
+		return &protos.Operation{Name: name, Done: n == 3}, nil
+	})
+
+	res := bluectl(t, h, "ops", "wait", "ops/123")
+	if res.ExitCode != 0 {
+		t.Fatalf("exit code %v, stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	if out := res.Stdout + res.Stderr; !strings.Contains(out, "[ops/123] done") {
+		t.Errorf("output does not include done:\n%s", out)
+	}
+
+	if calls := h.Fake.Calls(operations.Operations_WaitOperation_FullMethodName); len(calls) != 3 {
+		t.Errorf("got %v calls, want 3", len(calls))
+	}
+
+	h.Fake.Fail(operations.Operations_WaitOperation_FullMethodName, status.Error(codes.NotFound, "not found"))
+	res = bluectl(t, h, "ops", "wait", "ops/404")
+	if res.ExitCode != 5 {
+		t.Errorf("got exit code %v, want 5; stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	res = bluectl(t, h, "ops", "wait")
+	if res.ExitCode != 2 {
+		t.Errorf("got exit code %v, want 2; stderr: %s", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestOpsWaitTimeout(t *testing.T) {
+	h := harness(t)
+	h.Fake.Unary(operations.Operations_WaitOperation_FullMethodName, func(req proto.Message) (proto.Message, error) {
+		time.Sleep(300 * time.Millisecond)
+		return &protos.Operation{Name: req.(*operations.WaitOperationRequest).Name, Done: true}, nil
+	})
+
+	h.Fake.Unary(operations.Operations_GetOperation_FullMethodName, func(req proto.Message) (proto.Message, error) {
+		time.Sleep(300 * time.Millisecond)
+		return &protos.Operation{Name: req.(*operations.GetOperationRequest).Name}, nil
+	})
+
+	res := bluectl(t, h, "config", "set", "timeout", "100ms")
+	if res.ExitCode != 0 {
+		t.Fatalf("exit code %v, stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	// The profile's timeout doesn't apply to long-running commands.
+	res = bluectl(t, h, "ops", "wait", "ops/123")
+	if res.ExitCode != 0 {
+		t.Errorf("exit code %v, stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	res = bluectl(t, h, "ops", "wait", "ops/123", "--timeout", "100ms")
+	if res.ExitCode != 7 {
+		t.Errorf("got exit code %v, want 7; stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	res = bluectl(t, h, "ops", "get", "ops/123")
+	if res.ExitCode != 7 {
+		t.Errorf("got exit code %v, want 7; stderr: %s", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestPluginEnvDefaults(t *testing.T) {
+	h := harness(t)
+	h.Fake.Reply(operations.Operations_ListOperations_FullMethodName, &protos.Operation{Name: "ops/123"})
+	res := bluectl(t, h, "config", "set", "outfmt", "csv")
+	if res.ExitCode != 0 {
+		t.Fatalf("exit code %v, stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	res = bluectl(t, h, "ops", "list")
+	if !strings.HasPrefix(res.Stdout, "name,done") {
+		t.Errorf("profile outfmt: got %q", res.Stdout)
+	}
+
+	// As set for plugins; wins over the profile.
+	h.Env = []string{"ALPHAUS_OUTFMT=json"}
+	res = bluectl(t, h, "ops", "list")
+	if res.ExitCode != 0 || !strings.Contains(res.Stdout, `"name": "ops/123"`) {
+		t.Errorf("exit code %v, stdout: %q, stderr: %s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+}
+
+func TestRestPaginate(t *testing.T) {
+	h := harness(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/pages":
+			if r.URL.Query().Get("pageToken") == "" {
+				fmt.Fprint(w, `{"items":[1],"nextPageToken":"p2"}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"items":[2]}`)
+		case "/stream":
+			// Stream items can have a nextPageToken field too.
+			fmt.Fprint(w, `{"result":{"id":1,"nextPageToken":"x"}}`+"\n"+`{"result":{"id":2}}`)
+		}
+	}))
+
+	defer srv.Close()
+	res := bluectl(t, h, "rest", "GET", "/pages", "--paginate", "--rest-url", srv.URL, "--outfmt", "jsonl")
+	if want := "{\"items\":[1],\"nextPageToken\":\"p2\"}\n{\"items\":[2]}\n"; res.ExitCode != 0 || res.Stdout != want {
+		t.Errorf("exit code %v, got %q, want %q; stderr: %s", res.ExitCode, res.Stdout, want, res.Stderr)
+	}
+
+	res = bluectl(t, h, "rest", "GET", "/stream", "--rest-url", srv.URL, "--outfmt", "jsonl")
+	if want := "{\"id\":1,\"nextPageToken\":\"x\"}\n{\"id\":2}\n"; res.ExitCode != 0 || res.Stdout != want {
+		t.Errorf("exit code %v, got %q, want %q; stderr: %s", res.ExitCode, res.Stdout, want, res.Stderr)
+	}
+
+	res = bluectl(t, h, "rest", "GET", "/stream", "--paginate", "--rest-url", srv.URL)
+	if res.ExitCode != 2 || !strings.Contains(res.Stdout+res.Stderr, "--paginate") {
+		t.Errorf("got exit code %v, want 2; stderr: %s", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestCustomEnvWithoutRestUrl(t *testing.T) {
+	h := harness(t)
+	h.Fake.Reply(operations.Operations_ListOperations_FullMethodName, &protos.Operation{Name: "ops/123"})
+	res := bluectl(t, h, "--env", "custom", "ops", "list")
+	if res.ExitCode != 0 {
+		t.Errorf("exit code %v, stderr: %s", res.ExitCode, res.Stderr)
+	}
+
+	res = bluectl(t, h, "--env", "custom", "rest", "GET", "/m/blue/ops/v1/ops/123")
+	if res.ExitCode != 2 || !strings.Contains(res.Stdout+res.Stderr, "rest-url") {
+		t.Errorf("got exit code %v, want 2; stdout: %s, stderr: %s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+}
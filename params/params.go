@@ -1,13 +1,55 @@
 package params
 
+import "time"
+
 var (
 	Version string
 
-	AuthProfile  string
-	AuthUrl      string
-	ClientId     string
-	ClientSecret string
-	OutFile      string
-	OutFmt       string
-	CleanOut     bool
+	AuthProfile   string
+	AuthUrl       string
+	ClientId      string
+	ClientSecret  string
+	CredProcess   string // the profile's credential-process, run when a new token is needed
+	ClientIdFlag  bool   // true if --client-id is set, which wins over CredProcess
+	OutFile       string
+	OutFmt        string
+	CleanOut      bool
+	RemovePartial bool
+	ErrorFormat   string
+	Env           string
+	Endpoint      string
+	RestUrl       string
+	Plaintext     bool
+	Insecure      bool
+	CaCert        string
+	Timeout       time.Duration
+	Retries       int
+	NoTokenCache  bool
+	Verbose       bool
+	Trace         bool
+	OtelEndpoint  string
+	OtelFile      string
+	Record        string
+	Replay        string
+	Cache         bool
+	CacheTtl      time.Duration
+	RawInputVars  []string
 )
+
+// Reset sets all parameters to their zero values, before a new root command
+// sets their defaults again, i.e. when running more than one command in the
+// same process.
+func Reset() {
+	Version = ""
+	AuthProfile, AuthUrl, ClientId, ClientSecret = "", "", "", ""
+	CredProcess, ClientIdFlag = "", false
+	OutFile, OutFmt, CleanOut, RemovePartial, ErrorFormat = "", "", false, false, ""
+	Env, Endpoint, RestUrl = "", "", ""
+	Plaintext, Insecure, CaCert = false, false, ""
+	Timeout, Retries, NoTokenCache = 0, 0, false
+	Verbose, Trace = false, false
+	OtelEndpoint, OtelFile = "", ""
+	Record, Replay = "", ""
+	Cache, CacheTtl = false, 0
+	RawInputVars = nil
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alphauslabs/blue-sdk-go/session"
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/config"
+	"github.com/alphauslabs/bluectl/pkg/env"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// expirySkew is how long before the actual expiry we consider a cached
+// token expired, to leave room for clock skew and long-running calls.
+const expirySkew = 2 * time.Minute
+
+// Source provides access tokens for our services, cached on disk under
+// ~/.cache/alphaus/ (keyed by profile, login URL, client id, and a hash of
+// the credentials) until shortly before they expire.
+type Source struct {
+	Profile      string
+	LoginUrl     string
+	ClientId     string
+	ClientSecret string
+	Username     string // optional, implies the 'password' grant type
+	Password     string
+
+	// Optional. Command that outputs the client secret (and optionally the
+	// client id) instead of ClientSecret, run only when we need a new token;
+	// see config.RunCredentialProcess. Its client id replaces ClientId,
+	// unless KeepClientId is true.
+	CredentialProcess string
+	KeepClientId      bool
+
+	// If true, don't read or write the on-disk cache.
+	NoCache bool
+
+	// If true, always get a new token, then update the cache.
+	Refresh bool
+
+	// If true, tokens can be sent to gRPC services without TLS, i.e. with
+	// --plaintext, or to a loopback target.
+	Plaintext bool
+
+	mtx    sync.Mutex
+	cached *cachedToken
+}
+
+type cachedToken struct {
+	AccessToken string    `json:"accessToken"`
+	Expiry      time.Time `json:"expiry"`
+
+	persist bool // false if expiry is unknown
+}
+
+func (t *cachedToken) valid() bool {
+	return t != nil && t.AccessToken != "" && time.Now().Add(expirySkew).Before(t.Expiry)
+}
+
+// Default returns a Source based on the global flags, the loaded profile, and
+// the current environment. Empty credentials fall back to the SDK's
+// environment variables.
+func Default() (*Source, error) {
+	e, err := env.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Source{
+		Profile:           params.AuthProfile,
+		LoginUrl:          e.LoginUrl,
+		ClientId:          params.ClientId,
+		ClientSecret:      params.ClientSecret,
+		CredentialProcess: params.CredProcess,
+		KeepClientId:      params.ClientIdFlag,
+		NoCache:           params.NoTokenCache,
+	}
+
+	if s.ClientId == "" && s.ClientSecret == "" && s.CredentialProcess == "" {
+		id, secret, _, _, loginUrl := session.GetLocalCreds()
+		s.ClientId, s.ClientSecret = id, secret
+		if e.Name == env.NameProd && params.AuthUrl == "" {
+			s.LoginUrl = loginUrl // i.e. Wave credentials
+		}
+	}
+
+	return s, nil
+}
+
+// Token returns a valid access token, from the cache if possible.
+func (s *Source) Token() (string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.Refresh {
+		if s.cached.valid() {
+			return s.cached.AccessToken, nil
+		}
+
+		if !s.NoCache {
+			if t := s.read(); t.valid() {
+				s.cached = t
+				return t.AccessToken, nil
+			}
+		}
+	}
+
+	t, err := s.exchange()
+	if err != nil {
+		return "", err
+	}
+
+	s.Refresh = false // only once
+	s.cached = t
+	if !s.NoCache && t.persist {
+		s.write(t) // best effort
+	}
+
+	return t.AccessToken, nil
+}
+
+// Credentials returns the client id and secret, from CredentialProcess if set.
+func (s *Source) Credentials() (string, string, error) {
+	if s.CredentialProcess == "" {
+		return s.ClientId, s.ClientSecret, nil
+	}
+
+	creds, err := config.RunCredentialProcess(s.CredentialProcess)
+	if err != nil {
+		return "", "", cmderr.Usage(fmt.Errorf("[%v] %w", s.Profile, err))
+	}
+
+	id := s.ClientId
+	if creds.ClientId != "" && !s.KeepClientId {
+		id = creds.ClientId
+	}
+
+	return id, creds.ClientSecret, nil
+}
+
+// Invalidate makes the next Token call get a new token, i.e. after the API
+// rejected the current one.
+func (s *Source) Invalidate() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.Refresh = true
+	s.cached = nil
+}
+
+// InvalidateToken is Invalidate, but only if tok is still the current token,
+// so concurrent calls rejected with the same token get a single new one.
+func (s *Source) InvalidateToken(tok string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.cached != nil && s.cached.AccessToken != tok {
+		return
+	}
+
+	s.Refresh = true
+	s.cached = nil
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (s *Source) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	t, err := s.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"authorization": "Bearer " + t}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials. Tokens
+// are never sent without TLS, unless Plaintext is true.
+func (s *Source) RequireTransportSecurity() bool { return !s.Plaintext }
+
+// CacheDir returns the location of our cached tokens.
+func CacheDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "alphaus")
+}
+
+func (s *Source) file() string {
+	// So a wrong secret or password doesn't authenticate from the cache.
+	creds := sha256.Sum256([]byte(strings.Join([]string{
+		s.ClientSecret,
+		s.Password,
+		s.CredentialProcess,
+	}, "\x00")))
+
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		s.Profile,
+		s.LoginUrl,
+		s.ClientId,
+		s.Username,
+		hex.EncodeToString(creds[:]),
+	}, "\x00")))
+
+	return filepath.Join(CacheDir(), "token-"+hex.EncodeToString(h[:8])+".json")
+}
+
+func (s *Source) read() *cachedToken {
+	b, err := os.ReadFile(s.file())
+	if err != nil {
+		return nil
+	}
+
+	var t cachedToken
+	if json.Unmarshal(b, &t) != nil {
+		return nil
+	}
+
+	return &t
+}
+
+func (s *Source) write(t *cachedToken) error {
+	err := os.MkdirAll(CacheDir(), 0700)
+	if err != nil {
+		return err
+	}
+
+	b, _ := json.Marshal(t)
+	tmp, err := os.CreateTemp(CacheDir(), ".token.*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // no-op after rename
+	_, err = tmp.Write(b)
+	if e := tmp.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp already uses 0600.
+	return os.Rename(tmp.Name(), s.file())
+}
+
+// exchange gets a new access token from the login URL. Similar to the SDK's
+// session.AccessToken() but we also need the token's expiry.
+func (s *Source) exchange() (*cachedToken, error) {
+	id, secret, err := s.Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Add("client_id", id)
+	form.Add("client_secret", secret)
+	form.Add("scope", "openid")
+	switch {
+	case s.Username != "" || s.Password != "":
+		form.Add("grant_type", "password")
+		form.Add("username", s.Username)
+		form.Add("password", s.Password)
+	default:
+		form.Add("grant_type", "client_credentials")
+	}
+
+	timeout := 60 * time.Second
+	if params.Timeout > 0 {
+		timeout = params.Timeout
+	}
+
+	hc := &http.Client{Timeout: timeout}
+	resp, err := hc.PostForm(s.LoginUrl, form)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "login failed: %v", err)
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, status.Errorf(codes.Unavailable, "login failed: %v", resp.Status)
+	case (resp.StatusCode / 100) != 2:
+		return nil, status.Errorf(codes.Unauthenticated, "login failed: %v", resp.Status)
+	}
+
+	var r struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.AccessToken == "" {
+		return nil, status.Error(codes.Unauthenticated, "cannot find access token")
+	}
+
+	t := cachedToken{AccessToken: r.AccessToken, persist: true}
+	switch {
+	case r.ExpiresIn > 0:
+		t.Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	default:
+		t.Expiry = jwtExpiry(r.AccessToken)
+		if t.Expiry.IsZero() {
+			// Unknown expiry; reuse within this process only.
+			t.Expiry = time.Now().Add(expirySkew + 5*time.Minute)
+			t.persist = false
+		}
+	}
+
+	return &t, nil
+}
+
+// jwtExpiry returns the 'exp' claim of a JWT, without verification.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+
+	if json.Unmarshal(b, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
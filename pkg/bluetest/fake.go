@@ -0,0 +1,297 @@
+// Package bluetest provides a fake Blue API (gRPC services plus an OAuth2
+// token endpoint) on localhost, and a harness that runs bluectl commands
+// in-process against it, for hermetic command tests. For example, in package
+// main:
+//
+//	h, err := bluetest.NewHarness(run)
+//	...
+//	defer h.Close()
+//	h.Fake.Reply(cost.Cost_ListPayerAccounts_FullMethodName,
+//		&api.Account{Id: "000000000001", Name: "payer1"},
+//	)
+//
+//	res, err := h.Run("awspayer", "list", "--outfmt", "json")
+//	// check res.Stdout, res.Stderr, res.ExitCode
+package bluetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/alphauslabs/blue-sdk-go/admin/v1"
+	"github.com/alphauslabs/blue-sdk-go/billing/v1"
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/blue-sdk-go/iam/v1"
+	"github.com/alphauslabs/blue-sdk-go/operations/v1"
+	"github.com/alphauslabs/blue-sdk-go/org/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// ClientId and ClientSecret are the only credentials our fake token
+	// endpoint accepts.
+	ClientId     = "bluetest-client-id"
+	ClientSecret = "bluetest-client-secret"
+
+	// AccessToken is the token returned by our fake token endpoint.
+	AccessToken = "bluetest-access-token"
+)
+
+// Services is the list of services served by Fake.
+var Services = []string{
+	cost.Cost_ServiceDesc.ServiceName,
+	billing.Billing_ServiceDesc.ServiceName,
+	operations.Operations_ServiceDesc.ServiceName,
+	iam.Iam_ServiceDesc.ServiceName,
+	admin.Admin_ServiceDesc.ServiceName,
+	org.Organization_ServiceDesc.ServiceName,
+}
+
+// UnaryFunc handles a unary call. req is the decoded request message.
+type UnaryFunc func(req proto.Message) (proto.Message, error)
+
+// StreamFunc handles a server-streaming call. Call send for each response.
+type StreamFunc func(req proto.Message, send func(proto.Message) error) error
+
+// Call is a recorded request.
+type Call struct {
+	Method   string // full method name, i.e. /blueapi.cost.v1.Cost/ListPayerAccounts
+	Request  proto.Message
+	Metadata metadata.MD
+}
+
+type handler struct {
+	unary  UnaryFunc
+	stream StreamFunc
+}
+
+// Fake is a fake Blue API. Methods without a handler return codes.Unimplemented.
+type Fake struct {
+	// Addr is the gRPC server address (host:port), to be used with --endpoint.
+	Addr string
+
+	// AuthUrl is the OAuth2 token endpoint, to be used with --auth-url.
+	AuthUrl string
+
+	srv  *grpc.Server
+	auth *httptest.Server
+
+	mtx      sync.Mutex
+	handlers map[string]handler
+	calls    []Call
+}
+
+// NewFake starts the fake gRPC server and token endpoint on localhost.
+func NewFake() (*Fake, error) {
+	f := &Fake{handlers: map[string]handler{}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	f.Addr = l.Addr().String()
+	f.srv = grpc.NewServer(grpc.UnknownServiceHandler(f.serve))
+	go f.srv.Serve(l)
+
+	f.auth = httptest.NewServer(http.HandlerFunc(f.token))
+	f.AuthUrl = f.auth.URL + "/access_token"
+	return f, nil
+}
+
+// Close stops all servers.
+func (f *Fake) Close() {
+	f.srv.Stop()
+	f.auth.Close()
+}
+
+// Unary sets the handler for a unary method.
+func (f *Fake) Unary(method string, fn UnaryFunc) {
+	if md := mustMethod(method); md.IsStreamingServer() {
+		panic(fmt.Sprintf("bluetest: %v is a streaming method", method))
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.handlers[method] = handler{unary: fn}
+}
+
+// Stream sets the handler for a server-streaming method.
+func (f *Fake) Stream(method string, fn StreamFunc) {
+	if md := mustMethod(method); !md.IsStreamingServer() {
+		panic(fmt.Sprintf("bluetest: %v is not a streaming method", method))
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.handlers[method] = handler{stream: fn}
+}
+
+// Reply is a helper for scripting fixed responses. For unary methods, resp
+// must be exactly one message; for streaming methods, all of resp are sent
+// in order.
+func (f *Fake) Reply(method string, resp ...proto.Message) {
+	switch md := mustMethod(method); {
+	case md.IsStreamingServer():
+		f.Stream(method, func(req proto.Message, send func(proto.Message) error) error {
+			for _, m := range resp {
+				if err := send(m); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	default:
+		if len(resp) != 1 {
+			panic(fmt.Sprintf("bluetest: %v expects exactly one response", method))
+		}
+
+		f.Unary(method, func(req proto.Message) (proto.Message, error) {
+			return resp[0], nil
+		})
+	}
+}
+
+// Fail makes method return err, usually from status.Error.
+func (f *Fake) Fail(method string, err error) {
+	switch md := mustMethod(method); {
+	case md.IsStreamingServer():
+		f.Stream(method, func(proto.Message, func(proto.Message) error) error { return err })
+	default:
+		f.Unary(method, func(proto.Message) (proto.Message, error) { return nil, err })
+	}
+}
+
+// Calls returns the recorded requests for method, or all if method is empty.
+func (f *Fake) Calls(method string) []Call {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var calls []Call
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+func (f *Fake) serve(srv any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	md, err := findMethod(method)
+	if err != nil {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	req := mt.New().Interface()
+	err = stream.RecvMsg(req)
+	if err != nil {
+		return err
+	}
+
+	hdrs, _ := metadata.FromIncomingContext(stream.Context())
+	if v := hdrs.Get("authorization"); len(v) == 0 || v[0] != "Bearer "+AccessToken {
+		return status.Error(codes.Unauthenticated, "bluetest: invalid or missing access token")
+	}
+
+	f.mtx.Lock()
+	f.calls = append(f.calls, Call{Method: method, Request: req, Metadata: hdrs})
+	h, ok := f.handlers[method]
+	f.mtx.Unlock()
+
+	switch {
+	case !ok:
+		return status.Errorf(codes.Unimplemented, "bluetest: no handler for %v", method)
+	case h.stream != nil:
+		return h.stream(req, func(m proto.Message) error { return stream.SendMsg(m) })
+	default:
+		resp, err := h.unary(req)
+		if err != nil {
+			return err
+		}
+
+		return stream.SendMsg(resp)
+	}
+}
+
+// token is our fake OAuth2 token endpoint (client_credentials only).
+func (f *Fake) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if r.PostForm.Get("client_id") != ClientId || r.PostForm.Get("client_secret") != ClientSecret {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+// findMethod returns the descriptor of a full method name, limited to our Services.
+func findMethod(method string) (protoreflect.MethodDescriptor, error) {
+	svc, name, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("bluetest: invalid method: %v", method)
+	}
+
+	var found bool
+	for _, s := range Services {
+		if s == svc {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("bluetest: unsupported service: %v", svc)
+	}
+
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(svc))
+	if err != nil {
+		return nil, err
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("bluetest: %v is not a service", svc)
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("bluetest: unknown method: %v", method)
+	}
+
+	return md, nil
+}
+
+func mustMethod(method string) protoreflect.MethodDescriptor {
+	md, err := findMethod(method)
+	if err != nil {
+		panic(err)
+	}
+
+	return md
+}
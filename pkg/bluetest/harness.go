@@ -0,0 +1,197 @@
+package bluetest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/fatih/color"
+)
+
+// Main runs bluectl in-process with args (without the program name) and
+// returns its exit code, i.e. the run function of package main.
+type Main func(ctx context.Context, args []string) int
+
+// Result is the outcome of a bluectl run.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Commands use the process' stdout, stderr and environment, so only one
+// runs at a time, across all harnesses.
+var runMtx sync.Mutex
+
+// Harness runs bluectl commands in-process against a Fake, with an isolated
+// $HOME so the user's profiles and caches are never used.
+type Harness struct {
+	Main Main
+	Fake *Fake
+	Home string // temporary $HOME
+
+	// Additional environment variables (KEY=VALUE) for every run.
+	Env []string
+}
+
+// NewHarness starts a Fake and returns a Harness that runs commands with main.
+func NewHarness(main Main) (*Harness, error) {
+	h := &Harness{Main: main}
+	var err error
+	h.Home, err = os.MkdirTemp("", "bluetest-home-")
+	if err != nil {
+		return nil, err
+	}
+
+	h.Fake, err = NewFake()
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Close stops the Fake and removes our temporary files.
+func (h *Harness) Close() {
+	if h.Fake != nil {
+		h.Fake.Close()
+	}
+
+	if h.Home != "" {
+		os.RemoveAll(h.Home)
+	}
+}
+
+// Run runs bluectl with args against our Fake.
+func (h *Harness) Run(args ...string) (*Result, error) {
+	return h.RunContext(context.Background(), args...)
+}
+
+// RunContext is Run with a context; the command is canceled when ctx is
+// done. A non-zero exit code is not an error; check Result.ExitCode.
+//
+// Stdout and stderr are captured for the duration of the command, stdin is
+// empty, and the environment only has the variables of environ, plus Env.
+func (h *Harness) RunContext(ctx context.Context, args ...string) (*Result, error) {
+	runMtx.Lock()
+	defer runMtx.Unlock()
+
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+
+	defer stdin.Close()
+	var stdout, stderr bytes.Buffer
+	outw, outDone, err := capture(&stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	errw, errDone, err := capture(&stderr)
+	if err != nil {
+		outw.Close()
+		<-outDone
+		return nil, err
+	}
+
+	restoreEnv := setEnv(append(h.environ(), h.Env...))
+	saved := [3]*os.File{os.Stdin, os.Stdout, os.Stderr}
+	os.Stdin, os.Stdout, os.Stderr = stdin, outw, errw
+	setLogOutput(outw)
+	noColor := color.NoColor
+	color.NoColor = true
+	logger.SetPrefix(logger.PrefixDefault)
+
+	code := h.Main(ctx, append([]string{"--plaintext"}, args...))
+
+	color.NoColor = noColor
+	setLogOutput(saved[1])
+	os.Stdin, os.Stdout, os.Stderr = saved[0], saved[1], saved[2]
+	restoreEnv()
+	outw.Close()
+	errw.Close()
+	<-outDone
+	<-errDone
+	return &Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: code,
+	}, nil
+}
+
+// capture returns a pipe whose output is copied to buf, and a channel that
+// is closed once everything written to the pipe is in buf.
+func capture(buf *bytes.Buffer) (*os.File, chan struct{}, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(buf, r)
+		r.Close()
+		close(done)
+	}()
+
+	return w, done, nil
+}
+
+// setLogOutput sends the SDK logger, which writes to the stdout it saw when
+// initialized, to w instead.
+func setLogOutput(w *os.File) {
+	saved := os.Stderr
+	os.Stderr = w
+	logger.SendToStderr(true)
+	os.Stderr = saved
+}
+
+// setEnv replaces the process environment with env, and returns a function
+// that restores it.
+func setEnv(env []string) func() {
+	saved := os.Environ()
+	set := func(env []string) {
+		os.Clearenv()
+		for _, kv := range env {
+			if kv == "" {
+				continue
+			}
+
+			// Windows has entries like "=C:=C:\", that start with '='.
+			k, v, ok := strings.Cut(kv[1:], "=")
+			if ok {
+				os.Setenv(kv[:1]+k, v)
+			}
+		}
+	}
+
+	set(env)
+	return func() { set(saved) }
+}
+
+// environ returns a minimal environment; none of the caller's ALPHAUS_*
+// variables are passed through.
+func (h *Harness) environ() []string {
+	env := []string{
+		"HOME=" + h.Home,
+		"USERPROFILE=" + h.Home, // windows
+		"PATH=" + os.Getenv("PATH"),
+		"ALPHAUS_ENDPOINT=" + h.Fake.Addr,
+		"ALPHAUS_AUTH_URL=" + h.Fake.AuthUrl,
+		"ALPHAUS_CLIENT_ID=" + ClientId,
+		"ALPHAUS_CLIENT_SECRET=" + ClientSecret,
+	}
+
+	if runtime.GOOS == "windows" {
+		env = append(env, "SYSTEMROOT="+os.Getenv("SYSTEMROOT"))
+	}
+
+	return env
+}
@@ -0,0 +1,319 @@
+// Package cache is our local cache of cost query results (--cache). Each
+// entry is the complete, gzipped response stream of a request, with a JSON
+// metadata file, under ~/.cache/alphaus/query/.
+package cache
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	dataExt = ".pb.gz"
+	metaExt = ".json"
+	tmpExt  = ".tmp"
+
+	// DefaultTtl is the default for --cache-ttl.
+	DefaultTtl = 24 * time.Hour
+)
+
+// Methods is the list of (streaming) methods whose results can be cached.
+var Methods = map[string]bool{
+	cost.Cost_ReadCosts_FullMethodName:          true,
+	cost.Cost_ReadAdjustments_FullMethodName:    true,
+	cost.Cost_ReadTagCosts_FullMethodName:       true,
+	cost.Cost_ReadCostAttributes_FullMethodName: true,
+}
+
+// Entry is the metadata of a cached result.
+type Entry struct {
+	Key     string          `json:"key"`
+	Method  string          `json:"method"`
+	Request json.RawMessage `json:"request"`
+	Rows    int             `json:"rows"`
+	Size    int64           `json:"size"` // compressed
+	Created time.Time       `json:"created"`
+	Expires time.Time       `json:"expires"`
+}
+
+// Expired returns true if e is past its expiry.
+func (e *Entry) Expired() bool { return time.Now().After(e.Expires) }
+
+// Dir returns the location of our cached results.
+func Dir() string { return filepath.Join(auth.CacheDir(), "query") }
+
+// Key returns the cache key of a request. scope identifies the caller (i.e.
+// target, profile, and client id), so results are never shared between
+// different accounts.
+func Key(scope, method string, req proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, s := range []string{scope, method} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Cacheable returns true if req only covers closed months, i.e. its end
+// time is before the current month (UTC). Results for the current month
+// still change, so they are never cached.
+func Cacheable(req proto.Message) bool {
+	r, ok := req.(interface{ GetEndTime() string })
+	if !ok {
+		return false
+	}
+
+	end := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+
+		return -1
+	}, r.GetEndTime())
+
+	switch {
+	case len(end) >= 8:
+		end = end[:8]
+	case len(end) == 6: // yyyymm
+		end += "01"
+	default:
+		return false
+	}
+
+	return end < time.Now().UTC().Format("200601")+"01"
+}
+
+// Ttl returns the effective --cache-ttl.
+func Ttl() time.Duration {
+	if params.CacheTtl > 0 {
+		return params.CacheTtl
+	}
+
+	return DefaultTtl
+}
+
+// Reader reads the messages of a cached result.
+type Reader struct {
+	f  *os.File
+	gz *gzip.Reader
+	br *bufio.Reader
+}
+
+// Open returns a Reader for key, or nil if not cached or expired.
+func Open(key string) *Reader {
+	e, err := read(key)
+	if err != nil || e.Expired() {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(Dir(), key+dataExt))
+	if err != nil {
+		return nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil
+	}
+
+	return &Reader{f: f, gz: gz, br: bufio.NewReader(gz)}
+}
+
+// Next reads the next message into m. Returns io.EOF at the end.
+func (r *Reader) Next(m proto.Message) error {
+	err := protodelim.UnmarshalFrom(r.br, m)
+	if err != nil {
+		r.Close()
+	}
+
+	return err
+}
+
+// Close closes r. Safe to call more than once.
+func (r *Reader) Close() {
+	r.gz.Close()
+	r.f.Close()
+}
+
+// Writer writes a new cached result. It is only visible to readers after Commit.
+type Writer struct {
+	e  Entry
+	f  *os.File
+	gz *gzip.Writer
+	bw *bufio.Writer
+}
+
+// Create returns a Writer for the result of req.
+func Create(key, method string, req proto.Message) (*Writer, error) {
+	err := os.MkdirAll(Dir(), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(Dir(), key+"-*"+tmpExt)
+	if err != nil {
+		return nil, err
+	}
+
+	b, _ := protojson.Marshal(req)
+	w := &Writer{
+		e:  Entry{Key: key, Method: method, Request: b},
+		f:  f,
+		gz: gzip.NewWriter(f),
+	}
+
+	w.bw = bufio.NewWriter(w.gz)
+	return w, nil
+}
+
+// Write appends m to the result.
+func (w *Writer) Write(m proto.Message) error {
+	_, err := protodelim.MarshalTo(w.bw, m)
+	if err == nil {
+		w.e.Rows++
+	}
+
+	return err
+}
+
+// Commit saves the result. Call only if the stream completed successfully.
+func (w *Writer) Commit() error {
+	err := errors.Join(w.bw.Flush(), w.gz.Close(), w.f.Close())
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+
+	if fi, err := os.Stat(w.f.Name()); err == nil {
+		w.e.Size = fi.Size()
+	}
+
+	w.e.Created = time.Now().UTC()
+	w.e.Expires = w.e.Created.Add(Ttl())
+	err = os.Rename(w.f.Name(), filepath.Join(Dir(), w.e.Key+dataExt))
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+
+	b, _ := json.Marshal(w.e)
+	return writeFile(filepath.Join(Dir(), w.e.Key+metaExt), b)
+}
+
+// Abort discards the result.
+func (w *Writer) Abort() {
+	w.gz.Close()
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// List returns all cached entries, newest first.
+func List() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(Dir(), "*"+metaExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		e, err := read(strings.TrimSuffix(filepath.Base(f), metaExt))
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, *e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.After(entries[j].Created)
+	})
+
+	return entries, nil
+}
+
+// Clear removes all cached entries, or only the expired ones (including
+// leftovers of interrupted writes), and returns the number of entries removed.
+func Clear(expiredOnly bool) (int, error) {
+	entries, err := List()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, e := range entries {
+		if expiredOnly && !e.Expired() {
+			continue
+		}
+
+		os.Remove(filepath.Join(Dir(), e.Key+dataExt))
+		if err := os.Remove(filepath.Join(Dir(), e.Key+metaExt)); err == nil {
+			n++
+		}
+	}
+
+	tmps, _ := filepath.Glob(filepath.Join(Dir(), "*"+tmpExt))
+	for _, f := range tmps {
+		os.Remove(f)
+	}
+
+	return n, nil
+}
+
+func read(key string) (*Entry, error) {
+	b, err := os.ReadFile(filepath.Join(Dir(), key+metaExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	err = json.Unmarshal(b, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// writeFile writes b to file atomically.
+func writeFile(file string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+"-*"+tmpExt)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), file)
+}
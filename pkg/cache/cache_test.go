@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/bluectl/params"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// put caches msgs as the result of key.
+func put(t *testing.T, key string, msgs ...string) {
+	t.Helper()
+	w, err := Create(key, cost.Cost_ReadCosts_FullMethodName, &cost.ReadCostsRequest{Vendor: "aws"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range msgs {
+		if err := w.Write(wrapperspb.String(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// get returns the cached messages of key, or nil if not cached.
+func get(t *testing.T, key string) []string {
+	t.Helper()
+	r := Open(key)
+	if r == nil {
+		return nil
+	}
+
+	msgs := []string{}
+	for {
+		var v wrapperspb.StringValue
+		err := r.Next(&v)
+		if err == io.EOF {
+			return msgs
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs = append(msgs, v.Value)
+	}
+}
+
+func TestKey(t *testing.T) {
+	req := &cost.ReadCostsRequest{Vendor: "aws", StartTime: "20260101", EndTime: "20260131"}
+	k1, _ := Key("scope", cost.Cost_ReadCosts_FullMethodName, req)
+	k2, _ := Key("scope", cost.Cost_ReadCosts_FullMethodName, proto.Clone(req))
+	if k1 != k2 {
+		t.Errorf("same request, different keys: %v, %v", k1, k2)
+	}
+
+	for _, k := range []func() (string, error){
+		func() (string, error) { return Key("other", cost.Cost_ReadCosts_FullMethodName, req) },
+		func() (string, error) { return Key("scope", cost.Cost_ReadTagCosts_FullMethodName, req) },
+		func() (string, error) {
+			return Key("scope", cost.Cost_ReadCosts_FullMethodName, &cost.ReadCostsRequest{Vendor: "aws", StartTime: "20260101", EndTime: "20260130"})
+		},
+	} {
+		if k, _ := k(); k == k1 {
+			t.Errorf("different requests, same key %v", k)
+		}
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	month := time.Now().UTC().Format("200601")
+	last := time.Now().UTC().AddDate(0, -1, -time.Now().UTC().Day()+1)
+	for _, tc := range []struct {
+		req  proto.Message
+		want bool
+	}{
+		{&cost.ReadCostsRequest{EndTime: "20200131"}, true},
+		{&cost.ReadCostsRequest{EndTime: "2020-01-31"}, true},
+		{&cost.ReadCostsRequest{EndTime: "202001"}, true},
+		{&cost.ReadCostsRequest{EndTime: last.Format("20060102")}, true},
+		{&cost.ReadCostsRequest{EndTime: month + "01"}, false},
+		{&cost.ReadCostsRequest{EndTime: month}, false},
+		{&cost.ReadCostsRequest{EndTime: ""}, false},
+		{&cost.ReadCostsRequest{EndTime: "2020"}, false},
+		{wrapperspb.String("20200131"), false}, // no end time
+	} {
+		if got := Cacheable(tc.req); got != tc.want {
+			t.Errorf("Cacheable(%v) = %v, want %v", tc.req, got, tc.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if got := get(t, "missing"); got != nil {
+		t.Errorf("got %v for a missing key", got)
+	}
+
+	put(t, "k1", "a", "b", "c")
+	put(t, "k2")
+	if got := get(t, "k1"); len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("k1: got %v", got)
+	}
+
+	if got := get(t, "k2"); got == nil || len(got) != 0 {
+		t.Errorf("k2: got %v, want an empty result", got)
+	}
+
+	// Aborted writes are not visible.
+	w, err := Create("k3", cost.Cost_ReadCosts_FullMethodName, &cost.ReadCostsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write(wrapperspb.String("x"))
+	w.Abort()
+	if got := get(t, "k3"); got != nil {
+		t.Errorf("k3: got %v after Abort", got)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Key != "k2" || entries[1].Key != "k1" {
+		t.Fatalf("List() = %+v, want k2, k1", entries)
+	}
+
+	if e := entries[1]; e.Rows != 3 || e.Size == 0 || e.Method != cost.Cost_ReadCosts_FullMethodName || e.Expired() {
+		t.Errorf("k1: got %+v", e)
+	}
+
+	// Expired entries are not used, and removed by Clear(true).
+	params.CacheTtl = time.Nanosecond
+	defer func() { params.CacheTtl = 0 }()
+	put(t, "k4", "a")
+	time.Sleep(time.Millisecond)
+	if got := get(t, "k4"); got != nil {
+		t.Errorf("k4: got %v, want nothing when expired", got)
+	}
+
+	os.WriteFile(filepath.Join(Dir(), "k5-123"+tmpExt), nil, 0600) // interrupted write
+	n, err := Clear(true)
+	if err != nil || n != 1 {
+		t.Errorf("Clear(true) = %v, %v, want 1", n, err)
+	}
+
+	if tmps, _ := filepath.Glob(filepath.Join(Dir(), "*"+tmpExt)); len(tmps) > 0 {
+		t.Errorf("Clear(true) left %v", tmps)
+	}
+
+	n, err = Clear(false)
+	if err != nil || n != 2 {
+		t.Errorf("Clear(false) = %v, %v, want 2", n, err)
+	}
+
+	if got := get(t, "k1"); got != nil {
+		t.Errorf("k1: got %v after Clear", got)
+	}
+}
@@ -0,0 +1,194 @@
+package cmderr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Exit codes. These are part of our CLI interface; don't change existing
+// values, only add new ones.
+const (
+	ExitOK              = 0
+	ExitError           = 1   // general error
+	ExitUsage           = 2   // invalid flags or arguments
+	ExitAuth            = 3   // authentication failed
+	ExitPermission      = 4   // permission denied
+	ExitNotFound        = 5   // resource not found
+	ExitInvalidArgument = 6   // request rejected by the API as invalid
+	ExitUnavailable     = 7   // API unavailable, timed out, or rate limited; retryable
+	ExitInterrupted     = 130 // interrupted by SIGINT/SIGTERM
+)
+
+// ExitCodesHelp describes our exit codes, for help texts.
+const ExitCodesHelp = `Exit codes:
+  0    success
+  1    general error
+  2    invalid flags or arguments
+  3    authentication failed
+  4    permission denied
+  5    resource not found
+  6    invalid argument (rejected by the API)
+  7    API unavailable, timed out, or rate limited (retryable)
+  130  interrupted`
+
+// ErrInterrupted is returned by commands that are stopped by a signal.
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrSilent is returned, with an exit code, by commands that have already
+// reported their outcome, i.e. 'diff --exit-code'. It's not printed.
+var ErrSilent = errors.New("silent exit")
+
+var running bool
+
+// Running marks the point where flags and arguments have been validated and
+// the command is about to run. Errors before this are usage errors. Call
+// from PersistentPreRun hooks.
+func Running() { running = true }
+
+// Reset clears the state of the previous command, i.e. when running more
+// than one command in the same process.
+func Reset() {
+	running = false
+	mtx.Lock()
+	defer mtx.Unlock()
+	requestId = ""
+}
+
+// Error is an error with an explicit exit code.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// WithCode returns err with an explicit exit code.
+func WithCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Code: code, Err: err}
+}
+
+// Usage returns err as a usage error.
+func Usage(err error) error { return WithCode(ExitUsage, err) }
+
+// Code returns the exit code for err.
+func Code(err error) int {
+	var e *Error
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, ErrInterrupted), errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitUnavailable
+	case !running:
+		return ExitUsage
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return ExitError
+	}
+
+	switch s.Code() {
+	case codes.Unauthenticated:
+		return ExitAuth
+	case codes.PermissionDenied:
+		return ExitPermission
+	case codes.NotFound:
+		return ExitNotFound
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return ExitInvalidArgument
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return ExitUnavailable
+	case codes.Canceled:
+		return ExitInterrupted
+	default:
+		return ExitError
+	}
+}
+
+// Handle reports err and returns its exit code. cmdpath is the full path of
+// the failed command, i.e. "bluectl awspayer get".
+func Handle(err error, cmdpath string) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	if IsJson() {
+		writeJson(os.Stderr, err, cmdpath)
+		return Code(err)
+	}
+
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		logger.Info(err)
+	default:
+		logger.Error(err)
+	}
+
+	return Code(err)
+}
+
+// HttpError returns a gRPC status error equivalent of a failed HTTP call, so
+// REST and gRPC failures map to the same exit codes. It reads resp's body:
+// the API's error body ({"code":...,"message":...,"details":[...]}) is used
+// as is, other bodies are added to the message.
+func HttpError(resp *http.Response) error {
+	SetRequestId(resp.Header.Get("X-Request-Id"))
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var body struct {
+		Code    codes.Code `json:"code"`
+		Message string     `json:"message"`
+	}
+
+	if json.Unmarshal(b, &body) == nil && body.Code > codes.OK && body.Code <= codes.Unauthenticated {
+		var s spb.Status
+		opts := protojson.UnmarshalOptions{DiscardUnknown: true}
+		if opts.Unmarshal(b, &s) == nil {
+			return status.ErrorProto(&s)
+		}
+
+		return status.Error(body.Code, body.Message) // i.e. details of unknown types
+	}
+
+	var c codes.Code
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		c = codes.Unauthenticated
+	case resp.StatusCode == http.StatusForbidden:
+		c = codes.PermissionDenied
+	case resp.StatusCode == http.StatusNotFound:
+		c = codes.NotFound
+	case resp.StatusCode == http.StatusBadRequest:
+		c = codes.InvalidArgument
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		c = codes.Unavailable
+	default:
+		c = codes.Unknown
+	}
+
+	msg := resp.Status
+	if t := strings.TrimSpace(string(b)); t != "" {
+		msg += ": " + t
+	}
+
+	return status.Error(c, msg)
+}
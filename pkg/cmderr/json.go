@@ -0,0 +1,110 @@
+package cmderr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // for details
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+var (
+	mtx       sync.Mutex
+	requestId string
+)
+
+// SetRequestId records the request id of the latest API call, if non-empty.
+func SetRequestId(id string) {
+	if id == "" {
+		return
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	requestId = id
+}
+
+// RequestId returns the request id of the latest API call, if any.
+func RequestId() string {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return requestId
+}
+
+// IsJson returns true if errors should be written as JSON objects, based on
+// --error-format, or --outfmt if not set.
+func IsJson() bool {
+	switch strings.ToLower(params.ErrorFormat) {
+	case FormatJson:
+		return true
+	case FormatText:
+		return false
+	}
+
+	switch output.Format() {
+	case output.FormatJson, output.FormatJsonl:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrorInfo is the JSON representation of a command error.
+type ErrorInfo struct {
+	// The gRPC status code name, i.e. NotFound; Unknown for non-API errors.
+	Code string `json:"code"`
+
+	// The process exit code.
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message"`
+
+	// The gRPC status details (i.e. google.rpc.BadRequest), in protojson format.
+	Details []json.RawMessage `json:"details,omitempty"`
+
+	Command   string `json:"command,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+}
+
+// Info returns the ErrorInfo of err.
+func Info(err error, cmdpath string) ErrorInfo {
+	info := ErrorInfo{
+		Code:      "Unknown",
+		ExitCode:  Code(err),
+		Message:   err.Error(),
+		Command:   cmdpath,
+		RequestId: RequestId(),
+	}
+
+	var e *Error
+	if s, ok := status.FromError(err); ok && !errors.As(err, &e) {
+		info.Code = s.Code().String()
+		info.Message = s.Message()
+		for _, d := range s.Proto().Details {
+			b, err := protojson.Marshal(d)
+			if err != nil {
+				b, _ = json.Marshal(map[string]string{"@type": d.TypeUrl})
+			}
+
+			info.Details = append(info.Details, b)
+		}
+	}
+
+	return info
+}
+
+func writeJson(w io.Writer, err error, cmdpath string) {
+	b, _ := json.Marshal(map[string]ErrorInfo{"error": Info(err, cmdpath)})
+	fmt.Fprintf(w, "%s\n", b)
+}
@@ -0,0 +1,155 @@
+// Package complete provides dynamic shell completions of resource ids (i.e.
+// payers, operations), queried from the API. Results are cached for a short
+// while under ~/.cache/alphaus/complete/, so repeated tabs stay fast.
+package complete
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"github.com/alphauslabs/bluectl/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Ttl is how long query results are reused for completions.
+	Ttl = time.Minute
+
+	// Max duration of a query; we don't want to hang the shell.
+	timeout = 5 * time.Second
+)
+
+// Lister returns completion candidates, as "value" or "value\tdescription".
+type Lister struct {
+	Name string // cache key
+	List func(ctx context.Context) ([]string, error)
+}
+
+type entry struct {
+	Items   []string  `json:"items"`
+	Created time.Time `json:"created"`
+}
+
+// Args returns a completion function for positional arguments: the nth
+// argument is completed using listers[n]. Use nil for arguments that have
+// no completions.
+func Args(listers ...*Lister) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= len(listers) || listers[len(args)] == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		return filter(query(cmd, args, listers[len(args)]), "", toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// Flag returns a completion function for flag values, for use with
+// cobra.Command.RegisterFlagCompletionFunc.
+func Flag(l *Lister) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return filter(query(cmd, args, l), "", toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// List returns a completion function for a comma-separated list of values
+// as the first argument, i.e. "id1,id2,id3".
+func List(l *Lister) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		var prefix string
+		if i := strings.LastIndex(toComplete, ","); i >= 0 {
+			prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+		}
+
+		done := map[string]bool{}
+		for _, v := range strings.Split(prefix, ",") {
+			done[v] = true
+		}
+
+		var items []string
+		for _, v := range query(cmd, args, l) {
+			if !done[strings.SplitN(v, "\t", 2)[0]] {
+				items = append(items, v)
+			}
+		}
+
+		return filter(items, prefix, toComplete), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+}
+
+// filter returns the items that start with toComplete, prepended with prefix.
+func filter(items []string, prefix, toComplete string) []string {
+	var out []string
+	for _, v := range items {
+		if strings.HasPrefix(v, toComplete) {
+			out = append(out, prefix+v)
+		}
+	}
+
+	return out
+}
+
+// query returns the results of l, from our cache if not older than Ttl.
+// Errors are only logged to cobra's debug file ($BASH_COMP_DEBUG_FILE), as
+// there's no way to report them in a shell completion.
+func query(cmd *cobra.Command, args []string, l *Lister) []string {
+	// Completions don't run our PersistentPreRun hooks (profile, env, etc.).
+	if root := cmd.Root(); root.PersistentPreRunE != nil {
+		if err := root.PersistentPreRunE(cmd, args); err != nil {
+			cobra.CompDebugln(err.Error(), false)
+			return nil
+		}
+	}
+
+	e, err := env.Current()
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+		return nil
+	}
+
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		e.GrpcTarget,
+		params.AuthProfile,
+		params.ClientId,
+		l.Name,
+	}, "\x00")))
+
+	file := filepath.Join(auth.CacheDir(), "complete", hex.EncodeToString(h[:8])+".json")
+	if b, err := os.ReadFile(file); err == nil {
+		var c entry
+		if json.Unmarshal(b, &c) == nil && time.Since(c.Created) < Ttl {
+			return c.Items
+		}
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	items, err := l.List(ctx)
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err == nil {
+		b, _ := json.Marshal(entry{Items: items, Created: time.Now()})
+		os.WriteFile(file, b, 0600)
+	}
+
+	return items
+}
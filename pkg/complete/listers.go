@@ -0,0 +1,229 @@
+package complete
+
+import (
+	"context"
+	"io"
+
+	"github.com/alphauslabs/blue-sdk-go/admin/v1"
+	"github.com/alphauslabs/blue-sdk-go/billing/v1"
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/blue-sdk-go/iam/v1"
+	"github.com/alphauslabs/blue-sdk-go/operations/v1"
+	"github.com/alphauslabs/bluectl/pkg/grpcconn"
+)
+
+// item returns a completion candidate with an optional description.
+func item(value, desc string) string {
+	if desc == "" {
+		return value
+	}
+
+	return value + "\t" + desc
+}
+
+// Payers completes AWS payer account ids.
+var Payers = &Lister{
+	Name: "payers",
+	List: func(ctx context.Context) ([]string, error) {
+		mycon, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := cost.NewClient(ctx, &cost.ClientOptions{Conn: mycon})
+		if err != nil {
+			return nil, err
+		}
+
+		defer client.Close()
+		stream, err := client.ListPayerAccounts(ctx, &cost.ListPayerAccountsRequest{Vendor: "aws"})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for {
+			v, err := stream.Recv()
+			if err == io.EOF {
+				return items, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item(v.Id, v.Name))
+		}
+	},
+}
+
+// Operations completes long-running operation names.
+var Operations = &Lister{
+	Name: "operations",
+	List: func(ctx context.Context) ([]string, error) {
+		mycon, err := grpcconn.GetConnection(ctx, grpcconn.OpsService)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := operations.NewClient(ctx, &operations.ClientOptions{Conn: mycon})
+		if err != nil {
+			return nil, err
+		}
+
+		defer client.Close()
+		stream, err := client.ListOperations(ctx, &operations.ListOperationsRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for {
+			v, err := stream.Recv()
+			if err == io.EOF {
+				return items, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			desc := "running"
+			if v.Done {
+				desc = "done"
+			}
+
+			items = append(items, item(v.Name, desc))
+		}
+	},
+}
+
+// CrossAccts completes the target accounts of cross-account access (xacct).
+var CrossAccts = &Lister{
+	Name: "xacct",
+	List: func(ctx context.Context) ([]string, error) {
+		mycon, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: mycon})
+		if err != nil {
+			return nil, err
+		}
+
+		defer client.Close()
+		stream, err := client.ListDefaultCostAccess(ctx, &admin.ListDefaultCostAccessRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for {
+			v, err := stream.Recv()
+			if err == io.EOF {
+				return items, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item(v.Target, v.Status))
+		}
+	},
+}
+
+// Idps completes identity provider ids.
+var Idps = &Lister{
+	Name: "idps",
+	List: func(ctx context.Context) ([]string, error) {
+		mycon, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := iam.NewClient(ctx, &iam.ClientOptions{Conn: mycon})
+		if err != nil {
+			return nil, err
+		}
+
+		defer client.Close()
+		resp, err := client.ListIdentityProviders(ctx, &iam.ListIdentityProvidersRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for _, d := range resp.Data {
+			items = append(items, item(d.Id, d.Name))
+		}
+
+		return items, nil
+	},
+}
+
+// Channels completes notification channel ids.
+var Channels = &Lister{
+	Name: "channels",
+	List: func(ctx context.Context) ([]string, error) {
+		con, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := admin.NewClient(ctx, &admin.ClientOptions{Conn: con})
+		if err != nil {
+			return nil, err
+		}
+
+		defer client.Close()
+		resp, err := client.ListNotificationChannels(ctx, &admin.ListNotificationChannelsRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for _, v := range resp.Channels {
+			items = append(items, item(v.Id, v.Name))
+		}
+
+		return items, nil
+	},
+}
+
+// BillingGroups completes the internal ids of AWS billing groups.
+var BillingGroups = &Lister{
+	Name: "billinggroups",
+	List: func(ctx context.Context) ([]string, error) {
+		mycon, err := grpcconn.GetConnection(ctx, grpcconn.BillingService)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := billing.NewClient(ctx, &billing.ClientOptions{Conn: mycon})
+		if err != nil {
+			return nil, err
+		}
+
+		defer client.Close()
+		stream, err := client.ListBillingGroups(ctx, &billing.ListBillingGroupsRequest{Vendors: "aws"})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for {
+			v, err := stream.Recv()
+			if err == io.EOF {
+				return items, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item(v.BillingInternalId, v.BillingGroupId+" "+v.BillingGroupName))
+		}
+	},
+}
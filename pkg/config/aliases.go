@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Positional parameters in alias commands, i.e. $1.
+var rxParam = regexp.MustCompile(`\$([0-9]+)`)
+
+// Aliases returns the sorted list of alias names.
+func (f *File) Aliases() []string {
+	m, _ := f.data[KeyAliases].(map[string]any)
+	var names []string
+	for k := range m {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Alias returns the command line of alias name.
+func (f *File) Alias(name string) (string, bool) {
+	m, _ := f.data[KeyAliases].(map[string]any)
+	v, ok := m[name].(string)
+	return v, ok
+}
+
+// SetAlias validates and sets an alias. command is a command line without
+// the leading 'bluectl', with shell-like quoting.
+func (f *File) SetAlias(name, command string) error {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\r\n'\"") {
+		return fmt.Errorf("invalid alias name: %q", name)
+	}
+
+	words, err := Split(command)
+	if err != nil {
+		return fmt.Errorf("alias %v: %w", name, err)
+	}
+
+	if len(words) == 0 {
+		return fmt.Errorf("alias %v: command cannot be empty", name)
+	}
+
+	m, ok := f.data[KeyAliases].(map[string]any)
+	if !ok {
+		if _, taken := f.data[KeyAliases]; taken {
+			return fmt.Errorf("[%v] is not a table", KeyAliases)
+		}
+
+		m = map[string]any{}
+		f.data[KeyAliases] = m
+	}
+
+	m[name] = command
+	return nil
+}
+
+// DeleteAlias removes an alias.
+func (f *File) DeleteAlias(name string) error {
+	m, _ := f.data[KeyAliases].(map[string]any)
+	if _, ok := m[name]; !ok {
+		return fmt.Errorf("alias [%v] not found in %v", name, f.path)
+	}
+
+	delete(m, name)
+	if len(m) == 0 {
+		delete(f.data, KeyAliases)
+	}
+
+	return nil
+}
+
+// Expand returns the arguments of an alias command line, with $1, $2, etc.
+// replaced by args. Arguments that are not referenced are appended.
+func Expand(command string, args []string) ([]string, error) {
+	words, err := Split(command)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make([]bool, len(args))
+	var missing int
+	for i, w := range words {
+		words[i] = rxParam.ReplaceAllStringFunc(w, func(p string) string {
+			n, _ := strconv.Atoi(p[1:])
+			if n < 1 || n > len(args) {
+				missing = max(missing, n)
+				return p
+			}
+
+			used[n-1] = true
+			return args[n-1]
+		})
+	}
+
+	if missing > 0 {
+		return nil, fmt.Errorf("requires at least %v argument(s), got %v", missing, len(args))
+	}
+
+	for i, a := range args {
+		if !used[i] {
+			words = append(words, a)
+		}
+	}
+
+	return words, nil
+}
+
+// Split splits a command line into words, with shell-like quoting: single
+// quotes are literal, double quotes allow \" and \\, and a backslash outside
+// quotes escapes the next character.
+func Split(s string) ([]string, error) {
+	var words []string
+	var w strings.Builder
+	var inWord bool
+	var quote rune
+	var escape bool
+	for _, r := range s {
+		switch {
+		case escape:
+			if quote == '"' && r != '"' && r != '\\' {
+				w.WriteRune('\\')
+			}
+
+			w.WriteRune(r)
+			escape = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+				continue
+			}
+
+			w.WriteRune(r)
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escape = true
+			default:
+				w.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			escape = true
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			if inWord {
+				words = append(words, w.String())
+				w.Reset()
+				inWord = false
+			}
+		default:
+			w.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escape {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+
+	if inWord {
+		words = append(words, w.String())
+	}
+
+	return words, nil
+}
+
+// Quote returns args as a command line for Split, quoting where needed.
+func Quote(args []string) string {
+	var out []string
+	for _, a := range args {
+		switch {
+		case a == "":
+			out = append(out, "''")
+		case strings.ContainsAny(a, " \t\r\n'\"\\$`|&;<>(){}[]*?!#~"):
+			out = append(out, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+		default:
+			out = append(out, a)
+		}
+	}
+
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "cost aws usage get", want: []string{"cost", "aws", "usage", "get"}},
+		{in: "  a \t b\n", want: []string{"a", "b"}},
+		{in: `--raw-input '{"a": "b c"}'`, want: []string{"--raw-input", `{"a": "b c"}`}},
+		{in: `"a \"b\" \\ \n"`, want: []string{`a "b" \ \n`}},
+		{in: `a\ b c`, want: []string{"a b", "c"}},
+		{in: `'' x`, want: []string{"", "x"}},
+		{in: `pre'quoted'post`, want: []string{"prequotedpost"}},
+	} {
+		got, err := Split(tc.in)
+		if err != nil {
+			t.Errorf("Split(%q): %v", tc.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Split(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{`'open`, `"open`, `trailing\`} {
+		if _, err := Split(in); err == nil {
+			t.Errorf("Split(%q): expected an error", in)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, args := range [][]string{
+		{"cost", "aws", "usage", "get"},
+		{"--raw-input", `{"a": "b c"}`},
+		{"it's", "", "$1", `back\slash`},
+	} {
+		got, err := Split(Quote(args))
+		if err != nil {
+			t.Errorf("Split(Quote(%q)): %v", args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, args) {
+			t.Errorf("Split(Quote(%q)) = %q", args, got)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	for _, tc := range []struct {
+		command string
+		args    []string
+		want    []string
+		err     bool
+	}{
+		{
+			command: "cost aws usage get",
+			args:    []string{"--start", "20260801"},
+			want:    []string{"cost", "aws", "usage", "get", "--start", "20260801"},
+		},
+		{
+			command: "cost aws usage get --id $1",
+			args:    []string{"123", "--start", "20260801"},
+			want:    []string{"cost", "aws", "usage", "get", "--id", "123", "--start", "20260801"},
+		},
+		{
+			command: "x --a=$2 --b=$1-$1",
+			args:    []string{"one", "two"},
+			want:    []string{"x", "--a=two", "--b=one-one"},
+		},
+		{
+			command: "x '$1 $2'",
+			args:    []string{"a", "b c"},
+			want:    []string{"x", "a b c"},
+		},
+		{
+			command: "x $2",
+			args:    []string{"a"},
+			err:     true,
+		},
+		{
+			command: "x 'open",
+			err:     true,
+		},
+	} {
+		got, err := Expand(tc.command, tc.args)
+		switch {
+		case tc.err && err == nil:
+			t.Errorf("Expand(%q, %q): expected an error", tc.command, tc.args)
+		case !tc.err && err != nil:
+			t.Errorf("Expand(%q, %q): %v", tc.command, tc.args, err)
+		case !reflect.DeepEqual(got, tc.want):
+			t.Errorf("Expand(%q, %q) = %q, want %q", tc.command, tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "-x", "a b", `a"b`} {
+		if err := f.SetAlias(name, "version"); err == nil {
+			t.Errorf("SetAlias(%q): expected an error", name)
+		}
+	}
+
+	if err := f.SetAlias("empty", "  "); err == nil {
+		t.Error("SetAlias with an empty command: expected an error")
+	}
+
+	cmd := `cost aws usage get --id $1 --raw-input '{"awsOptions":{"groupByMonth":true}}'`
+	for name, command := range map[string]string{"usage": cmd, "v": "version"} {
+		if err := f.SetAlias(name, command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.Aliases(); !reflect.DeepEqual(got, []string{"usage", "v"}) {
+		t.Errorf("Aliases() = %v", got)
+	}
+
+	if got, ok := f.Alias("usage"); !ok || got != cmd {
+		t.Errorf("Alias(usage) = %q, %v", got, ok)
+	}
+
+	// Aliases are not profiles.
+	for _, p := range f.Profiles() {
+		if p == KeyAliases {
+			t.Errorf("Profiles() includes [%v]", KeyAliases)
+		}
+	}
+
+	if err := f.DeleteAlias("usage"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.DeleteAlias("usage"); err == nil {
+		t.Error("DeleteAlias of a missing alias: expected an error")
+	}
+
+	if err := f.DeleteAlias("v"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := f.data[KeyAliases]; ok {
+		t.Errorf("[%v] not removed after the last alias", KeyAliases)
+	}
+}
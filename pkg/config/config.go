@@ -0,0 +1,370 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/bluectl/pkg/output"
+	tomlv2 "github.com/pelletier/go-toml/v2"
+)
+
+const (
+	// KeyCurrentProfile is the top-level key for the profile to use when
+	// neither --profile nor $ALPHAUS_PROFILE is set.
+	KeyCurrentProfile = "current-profile"
+
+	// KeyAliases is the top-level table for command aliases (see Expand).
+	KeyAliases = "aliases"
+
+	// DefaultProfile is the profile name used when nothing else is set.
+	DefaultProfile = "default"
+
+	// EnvProfile is the environment variable for selecting a profile.
+	EnvProfile = "ALPHAUS_PROFILE"
+)
+
+// Keys is the list of supported profile settings.
+var Keys = []string{
+	"client-id",
+	"client-secret",
+	"client-secret-file",
+	"credential-process",
+	"auth-url",
+	"env",
+	"endpoint",
+	"rest-url",
+	"plaintext",
+	"insecure",
+	"ca-cert",
+	"outfmt",
+	"bare",
+	"timeout",
+}
+
+// Path returns the location of our config file.
+func Path() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "alphaus", "config.toml")
+}
+
+// File represents the contents of our config file. Top-level tables are
+// profiles (except [aliases]), the rest are global settings like current-profile.
+type File struct {
+	path   string
+	exists bool
+	data   map[string]any
+}
+
+// Load reads the config file. A missing file is not an error; it returns an
+// empty File that can be modified and saved.
+func Load() (*File, error) {
+	f := &File{path: Path(), data: map[string]any{}}
+	b, err := os.ReadFile(f.path)
+	switch {
+	case os.IsNotExist(err):
+		return f, nil
+	case err != nil:
+		return nil, err
+	}
+
+	err = tomlv2.Unmarshal(b, &f.data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", f.path, err)
+	}
+
+	if f.data == nil {
+		f.data = map[string]any{}
+	}
+
+	f.exists = true
+	return f, nil
+}
+
+// Path returns the file's location.
+func (f *File) Path() string { return f.path }
+
+// Exists returns true if the file was present during Load.
+func (f *File) Exists() bool { return f.exists }
+
+// Current returns the value of current-profile, if set.
+func (f *File) Current() string {
+	v, _ := f.data[KeyCurrentProfile].(string)
+	return v
+}
+
+// ProfileName returns the profile to use, in order of precedence: the value
+// of --profile, $ALPHAUS_PROFILE, current-profile, then "default". The
+// explicit return value is false when falling back to "default".
+func (f *File) ProfileName(flag string) (string, bool) {
+	switch {
+	case flag != "":
+		return flag, true
+	case os.Getenv(EnvProfile) != "":
+		return os.Getenv(EnvProfile), true
+	case f.Current() != "":
+		return f.Current(), true
+	default:
+		return DefaultProfile, false
+	}
+}
+
+// Profiles returns the sorted list of profile names.
+func (f *File) Profiles() []string {
+	var names []string
+	for k, v := range f.data {
+		if k == KeyAliases {
+			continue
+		}
+
+		if _, ok := v.(map[string]any); ok {
+			names = append(names, k)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the settings of profile name as strings.
+func (f *File) Profile(name string) (map[string]string, bool) {
+	if name == KeyAliases {
+		return nil, false
+	}
+
+	p, ok := f.data[name].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	m := make(map[string]string)
+	for k, v := range p {
+		m[k] = fmt.Sprintf("%v", v)
+	}
+
+	return m, true
+}
+
+// Use sets current-profile to name. The profile must exist.
+func (f *File) Use(name string) error {
+	if _, ok := f.Profile(name); !ok {
+		return fmt.Errorf("profile [%v] not found in %v", name, f.path)
+	}
+
+	f.data[KeyCurrentProfile] = name
+	return nil
+}
+
+// Set validates and sets a profile setting. The profile is created if needed.
+func (f *File) Set(name, key, value string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+
+	v, err := Parse(key, value)
+	if err != nil {
+		return err
+	}
+
+	p, ok := f.data[name].(map[string]any)
+	if !ok {
+		if _, taken := f.data[name]; taken {
+			return fmt.Errorf("[%v] is not a profile", name)
+		}
+
+		p = map[string]any{}
+		f.data[name] = p
+	}
+
+	if isSecretKey(key) {
+		for _, k := range SecretKeys {
+			if _, ok := p[k]; ok && k != key {
+				return fmt.Errorf("profile [%v] already has %v, unset it first", name, k)
+			}
+		}
+	}
+
+	p[key] = v
+	return nil
+}
+
+// Unset removes a profile setting.
+func (f *File) Unset(name, key string) error {
+	p, ok := f.data[name].(map[string]any)
+	if !ok || name == KeyAliases {
+		return fmt.Errorf("profile [%v] not found in %v", name, f.path)
+	}
+
+	if _, ok := p[key]; !ok {
+		return fmt.Errorf("[%v] is not set in profile [%v]", key, name)
+	}
+
+	delete(p, key)
+	return nil
+}
+
+// Rename renames a profile, updating current-profile if needed.
+func (f *File) Rename(from, to string) error {
+	p, ok := f.data[from].(map[string]any)
+	if !ok || from == KeyAliases {
+		return fmt.Errorf("profile [%v] not found in %v", from, f.path)
+	}
+
+	if err := validName(to); err != nil {
+		return err
+	}
+
+	if _, ok := f.data[to]; ok {
+		return fmt.Errorf("[%v] already exists", to)
+	}
+
+	f.data[to] = p
+	delete(f.data, from)
+	if f.Current() == from {
+		f.data[KeyCurrentProfile] = to
+	}
+
+	return nil
+}
+
+// Delete removes a profile, including current-profile if it points to it.
+func (f *File) Delete(name string) error {
+	if _, ok := f.Profile(name); !ok {
+		return fmt.Errorf("profile [%v] not found in %v", name, f.path)
+	}
+
+	delete(f.data, name)
+	if f.Current() == name {
+		delete(f.data, KeyCurrentProfile)
+	}
+
+	return nil
+}
+
+// Save writes the file atomically (write to a temporary file, then rename)
+// with owner-only permissions since it contains credentials. Note that
+// comments in the original file are not preserved.
+func (f *File) Save() error {
+	b, err := tomlv2.Marshal(f.data)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".config.toml.*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // no-op after rename
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if e := tmp.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), f.path)
+	if err != nil {
+		return err
+	}
+
+	f.exists = true
+	return nil
+}
+
+// Parse validates value for key and returns it in the type we store in the
+// file: bool for bare, plaintext, and insecure, string for the rest.
+func Parse(key, value string) (any, error) {
+	switch key {
+	case "client-id", "client-secret", "auth-url":
+		return value, nil
+	case "client-secret-file", "credential-process":
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("%v cannot be empty", key)
+		}
+
+		return value, nil
+	case "env":
+		switch value {
+		case "prod", "next", "custom":
+			return value, nil
+		default:
+			return nil, fmt.Errorf("invalid env: %v, valid values: prod, next, custom", value)
+		}
+	case "endpoint":
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %v, expected host:port", value)
+		}
+
+		return value, nil
+	case "rest-url":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid rest-url: %v, expected http(s)://host[:port]", value)
+		}
+
+		return value, nil
+	case "outfmt":
+		for _, f := range output.Formats {
+			if f == strings.ToLower(value) {
+				return f, nil
+			}
+		}
+
+		return nil, fmt.Errorf("invalid outfmt: %v, valid values: %v", value, strings.Join(output.Formats, ", "))
+	case "bare", "plaintext", "insecure":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %v, valid values: true, false", key, value)
+		}
+
+		return b, nil
+	case "ca-cert":
+		if _, err := os.Stat(value); err != nil {
+			return nil, fmt.Errorf("invalid ca-cert: %w", err)
+		}
+
+		return value, nil
+	case "timeout":
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %v, expected a duration, i.e. 30s, 5m", value)
+		}
+
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unknown key: %v, valid keys: %v", key, strings.Join(Keys, ", "))
+	}
+}
+
+func validName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("profile name cannot be empty")
+	case name == KeyCurrentProfile, name == KeyAliases:
+		return fmt.Errorf("[%v] is reserved", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SecretKeys are the mutually exclusive sources of a profile's client secret.
+var SecretKeys = []string{
+	"client-secret",
+	"client-secret-file",
+	"credential-process",
+}
+
+// ProcessCredentials is the expected JSON output of a credential-process
+// command. ClientId is optional; the profile's client-id is used if empty.
+type ProcessCredentials struct {
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+// ReadSecretFile returns the contents of file, with surrounding whitespace
+// (i.e. trailing newline) removed. A leading ~/ is expanded to $HOME.
+func ReadSecretFile(file string) (string, error) {
+	if strings.HasPrefix(file, "~/") {
+		home, _ := os.UserHomeDir()
+		file = filepath.Join(home, file[2:])
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("client-secret-file: %w", err)
+	}
+
+	secret := strings.TrimSpace(string(b))
+	if secret == "" {
+		return "", fmt.Errorf("client-secret-file: %v is empty", file)
+	}
+
+	return secret, nil
+}
+
+// RunCredentialProcess runs command using the system shell and parses its
+// standard output as ProcessCredentials. The command's standard error is
+// passed through so helpers can still log or prompt.
+func RunCredentialProcess(command string) (*ProcessCredentials, error) {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		c = exec.Command("cmd", "/C", command)
+	default:
+		c = exec.Command("sh", "-c", command)
+	}
+
+	var stdout bytes.Buffer
+	c.Stdin = os.Stdin
+	c.Stdout = &stdout
+	c.Stderr = os.Stderr
+	err := c.Run()
+	if err != nil {
+		return nil, fmt.Errorf("credential-process: %w", err)
+	}
+
+	var creds ProcessCredentials
+	err = json.Unmarshal(stdout.Bytes(), &creds)
+	if err != nil {
+		return nil, fmt.Errorf("credential-process: invalid output: %w", err)
+	}
+
+	if creds.ClientSecret == "" {
+		return nil, fmt.Errorf("credential-process: clientSecret is empty")
+	}
+
+	return &creds, nil
+}
+
+func isSecretKey(key string) bool {
+	for _, k := range SecretKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alphauslabs/blue-sdk-go/conn"
+	"github.com/alphauslabs/blue-sdk-go/session"
+	"github.com/alphauslabs/bluectl/params"
+)
+
+const (
+	NameProd   = "prod"
+	NameNext   = "next"
+	NameCustom = "custom"
+)
+
+// Names is the list of supported values for --env.
+var Names = []string{NameProd, NameNext, NameCustom}
+
+// Environment is the set of URLs that make up one of our environments.
+type Environment struct {
+	Name       string
+	LoginUrl   string // OAuth2 token endpoint
+	GrpcTarget string // host:port
+	RestBase   string // base URL for REST calls, no trailing slash
+}
+
+var (
+	Prod = Environment{
+		Name:       NameProd,
+		LoginUrl:   session.LoginUrlRipple,
+		GrpcTarget: conn.BlueEndpoint,
+		RestBase:   "https://api.alphaus.cloud",
+	}
+
+	Next = Environment{
+		Name:       NameNext,
+		LoginUrl:   session.LoginUrlRippleNext,
+		GrpcTarget: conn.BlueEndpointNext,
+		RestBase:   "https://apinext.alphaus.cloud",
+	}
+)
+
+// Current returns the environment selected by --env (or the profile's env).
+// If not set, the next environment is implied when --auth-url is one of the
+// next login URLs, otherwise prod. An explicit --auth-url always overrides
+// the environment's login URL, --endpoint its gRPC target, and --rest-url its
+// REST base URL. The custom environment requires auth-url and endpoint to be
+// set, and rest-url for REST calls; see Rest.
+func Current() (Environment, error) {
+	var e Environment
+	switch strings.ToLower(params.Env) {
+	case "":
+		e = Prod
+		switch params.AuthUrl {
+		case session.LoginUrlRippleNext, session.LoginUrlWaveNext:
+			e = Next
+		}
+	case NameProd:
+		e = Prod
+	case NameNext:
+		e = Next
+	case NameCustom:
+		e = Environment{
+			Name:       NameCustom,
+			GrpcTarget: params.Endpoint,
+			RestBase:   strings.TrimSuffix(params.RestUrl, "/"),
+		}
+
+		var missing []string
+		if params.AuthUrl == "" {
+			missing = append(missing, "auth-url")
+		}
+
+		if e.GrpcTarget == "" {
+			missing = append(missing, "endpoint")
+		}
+
+		if len(missing) > 0 {
+			return e, fmt.Errorf("env custom requires: %v", strings.Join(missing, ", "))
+		}
+	default:
+		return e, fmt.Errorf("invalid env: %v, valid values: %v", params.Env, strings.Join(Names, ", "))
+	}
+
+	if params.AuthUrl != "" {
+		e.LoginUrl = params.AuthUrl
+	}
+
+	if params.Endpoint != "" {
+		e.GrpcTarget = params.Endpoint
+	}
+
+	if params.RestUrl != "" {
+		e.RestBase = strings.TrimSuffix(params.RestUrl, "/")
+	}
+
+	return e, nil
+}
+
+// Rest returns the REST base URL, or an error if not set, i.e. for the custom
+// environment without rest-url.
+func (e Environment) Rest() (string, error) {
+	if e.RestBase == "" {
+		return "", fmt.Errorf("env %v requires: rest-url", e.Name)
+	}
+
+	return e.RestBase, nil
+}
@@ -0,0 +1,137 @@
+package grpcconn
+
+import (
+	"context"
+	"io"
+
+	"github.com/alphauslabs/bluectl/pkg/cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// cacheStream returns a stream interceptor that serves cache.Methods from
+// our local cache (--cache) when possible, and saves completed streams.
+// scope is used for the cache keys.
+func cacheStream(scope string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if !cache.Methods[method] {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		return &cacheClientStream{
+			ctx:    ctx,
+			method: method,
+			scope:  scope,
+			open: func() (grpc.ClientStream, error) {
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		}, nil
+	}
+}
+
+// cacheClientStream defers opening the actual stream until the request is
+// sent, so cache hits don't need the network at all.
+type cacheClientStream struct {
+	ctx    context.Context
+	method string
+	scope  string
+	open   func() (grpc.ClientStream, error)
+
+	cs grpc.ClientStream // actual stream, if not cached
+	r  *cache.Reader     // if cached
+	w  *cache.Writer     // if cacheable but not cached yet
+}
+
+func (s *cacheClientStream) SendMsg(m any) error {
+	if req, ok := m.(proto.Message); ok && cache.Cacheable(req) {
+		if key, err := cache.Key(s.scope, s.method, req); err == nil {
+			s.r = cache.Open(key)
+			if s.r != nil {
+				if Tracing() {
+					tracelog.Printf("    cache: hit %v", key)
+				}
+
+				return nil
+			}
+
+			s.w, _ = cache.Create(key, s.method, req)
+		}
+	}
+
+	var err error
+	s.cs, err = s.open()
+	if err != nil {
+		s.abort()
+		return err
+	}
+
+	return s.cs.SendMsg(m)
+}
+
+func (s *cacheClientStream) RecvMsg(m any) error {
+	if err := s.ctx.Err(); err != nil {
+		s.abort()
+		return err
+	}
+
+	if s.r != nil {
+		pm, _ := m.(proto.Message)
+		return s.r.Next(pm)
+	}
+
+	err := s.cs.RecvMsg(m)
+	if s.w == nil {
+		return err
+	}
+
+	switch {
+	case err == nil:
+		pm, _ := m.(proto.Message)
+		if s.w.Write(pm) != nil {
+			s.abort()
+		}
+	case err == io.EOF:
+		s.w.Commit()
+		s.w = nil
+	default:
+		s.abort()
+	}
+
+	return err
+}
+
+func (s *cacheClientStream) abort() {
+	if s.w != nil {
+		s.w.Abort()
+		s.w = nil
+	}
+}
+
+func (s *cacheClientStream) Header() (metadata.MD, error) {
+	if s.cs == nil {
+		return nil, nil
+	}
+
+	return s.cs.Header()
+}
+
+func (s *cacheClientStream) Trailer() metadata.MD {
+	if s.cs == nil {
+		return nil
+	}
+
+	return s.cs.Trailer()
+}
+
+func (s *cacheClientStream) CloseSend() error {
+	if s.cs == nil {
+		return nil
+	}
+
+	return s.cs.CloseSend()
+}
+
+func (s *cacheClientStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,490 @@
+package grpcconn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/alphauslabs/bluectl/params"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// interaction is a recorded call. Cassettes (--record, --replay) are JSON
+// lines files of interactions, in call order.
+type interaction struct {
+	Method string `json:"method"`
+
+	// The request, with secrets redacted (see --trace).
+	Request json.RawMessage `json:"request,omitempty"`
+
+	// All response messages; more than one for server streams.
+	Responses []json.RawMessage `json:"responses,omitempty"`
+
+	// The final status (google.rpc.Status), if not OK.
+	Status json.RawMessage `json:"status,omitempty"`
+
+	Header  metadata.MD `json:"header,omitempty"`
+	Trailer metadata.MD `json:"trailer,omitempty"`
+
+	used bool
+}
+
+func (it *interaction) err() error {
+	if len(it.Status) == 0 {
+		return nil
+	}
+
+	var s spb.Status
+	if err := protojson.Unmarshal(it.Status, &s); err != nil {
+		return status.Errorf(codes.Internal, "replay: invalid status: %v", err)
+	}
+
+	return status.ErrorProto(&s)
+}
+
+func (it *interaction) setErr(err error) {
+	if err == nil || err == io.EOF {
+		return
+	}
+
+	it.Status, _ = protojson.Marshal(status.Convert(err).Proto())
+}
+
+// request returns the cassette form of req, for recording and matching.
+func request(req any) json.RawMessage {
+	b, err := redactedJson(req)
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
+
+func response(m any) json.RawMessage {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	b, _ := protojson.Marshal(pm)
+	return b
+}
+
+func decode(b json.RawMessage, m any) error {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "replay: %T is not a proto message", m)
+	}
+
+	opts := protojson.UnmarshalOptions{DiscardUnknown: true}
+	return opts.Unmarshal(b, pm)
+}
+
+// recorder appends interactions to the --record file.
+type recorder struct {
+	mtx  sync.Mutex
+	f    *os.File
+	open map[*recordStream]struct{} // streams not written yet
+	err  error                      // first write error
+}
+
+var (
+	recOnce sync.Once
+	rec     *recorder
+	recErr  error
+)
+
+// getRecorder returns our recorder; the --record file is truncated once
+// per process, as a command can open several connections.
+func getRecorder() (*recorder, error) {
+	recOnce.Do(func() {
+		f, err := os.OpenFile(params.Record, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			recErr = err
+			return
+		}
+
+		rec = &recorder{f: f, open: map[*recordStream]struct{}{}}
+	})
+
+	return rec, recErr
+}
+
+// ResetCassettes forgets the --record and --replay files of the previous
+// command, i.e. when running more than one command in the same process.
+func ResetCassettes() {
+	recOnce, rec, recErr = sync.Once{}, nil, nil
+	playOnce, play, playErr = sync.Once{}, nil, nil
+}
+
+// FlushRecording writes the streams that were not read until the end (i.e.
+// the command failed or was interrupted), and closes the --record file.
+// Returns the first error writing the file, if any.
+func FlushRecording() error {
+	if rec == nil {
+		return nil
+	}
+
+	rec.mtx.Lock()
+	open := make([]*recordStream, 0, len(rec.open))
+	for s := range rec.open {
+		open = append(open, s)
+	}
+
+	rec.mtx.Unlock()
+	for _, s := range open {
+		s.finish(status.Error(codes.Canceled, "stream not read until the end when recorded"))
+	}
+
+	rec.mtx.Lock()
+	defer rec.mtx.Unlock()
+	if err := rec.f.Close(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+
+	return rec.err
+}
+
+func (r *recorder) write(it *interaction) error {
+	b, err := json.Marshal(it)
+	if err == nil {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		_, err = r.f.Write(append(b, '\n'))
+	}
+
+	if err != nil {
+		err = fmt.Errorf("record: %w", err)
+		if r.err == nil {
+			r.err = err
+		}
+	}
+
+	return err
+}
+
+func (r *recorder) unary(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+) error {
+	var hdr, trl metadata.MD
+	opts = append(opts, grpc.Header(&hdr), grpc.Trailer(&trl))
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	it := &interaction{
+		Method:  method,
+		Request: request(req),
+		Header:  hdr,
+		Trailer: trl,
+	}
+
+	switch {
+	case err == nil:
+		it.Responses = []json.RawMessage{response(reply)}
+	default:
+		it.setErr(err)
+	}
+
+	if werr := r.write(it); werr != nil && err == nil {
+		return werr
+	}
+
+	return err
+}
+
+func (r *recorder) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return &recordStream{
+		ctx: ctx,
+		rec: r,
+		it:  &interaction{Method: method},
+		open: func() (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, method, opts...)
+		},
+	}, nil
+}
+
+// recordStream records a stream's messages, and writes the interaction
+// once the stream ends, or in FlushRecording if it doesn't. The stream is
+// opened on first use, usually after the request is sent, so failures to
+// open it are recorded with the request too.
+type recordStream struct {
+	grpc.ClientStream // nil until opened
+
+	ctx     context.Context
+	rec     *recorder
+	it      *interaction
+	open    func() (grpc.ClientStream, error)
+	openErr error
+	once    sync.Once
+	err     error // from writing the interaction
+}
+
+// start opens the stream, if not yet opened.
+func (s *recordStream) start() error {
+	if s.ClientStream != nil || s.openErr != nil {
+		return s.openErr
+	}
+
+	cs, err := s.open()
+	if err != nil {
+		s.openErr = err
+		s.it.setErr(err)
+		s.rec.write(s.it) // the write error is returned by FlushRecording
+		return err
+	}
+
+	s.ClientStream = cs
+	s.rec.mtx.Lock()
+	s.rec.open[s] = struct{}{}
+	s.rec.mtx.Unlock()
+	return nil
+}
+
+func (s *recordStream) Header() (metadata.MD, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	return s.ClientStream.Header()
+}
+
+func (s *recordStream) Trailer() metadata.MD {
+	if s.ClientStream == nil {
+		return nil
+	}
+
+	return s.ClientStream.Trailer()
+}
+
+func (s *recordStream) CloseSend() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	return s.ClientStream.CloseSend()
+}
+
+func (s *recordStream) Context() context.Context {
+	if s.ClientStream == nil {
+		return s.ctx
+	}
+
+	return s.ClientStream.Context()
+}
+
+func (s *recordStream) SendMsg(m any) error {
+	s.it.Request = request(m)
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *recordStream) RecvMsg(m any) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.it.Responses = append(s.it.Responses, response(m))
+		return nil
+	}
+
+	if werr := s.finish(err); werr != nil && err == io.EOF {
+		return werr
+	}
+
+	return err
+}
+
+// finish writes the interaction once, with err as its final status.
+func (s *recordStream) finish(err error) error {
+	s.once.Do(func() {
+		s.rec.mtx.Lock()
+		delete(s.rec.open, s)
+		s.rec.mtx.Unlock()
+		s.it.setErr(err)
+		s.it.Header, _ = s.Header()
+		s.it.Trailer = s.Trailer()
+		s.err = s.rec.write(s.it)
+	})
+
+	return s.err
+}
+
+// player serves the interactions of the --replay file, without network.
+type player struct {
+	mtx   sync.Mutex
+	items []*interaction
+}
+
+var (
+	playOnce sync.Once
+	play     *player
+	playErr  error
+)
+
+func getPlayer() (*player, error) {
+	playOnce.Do(func() {
+		f, err := os.Open(params.Replay)
+		if err != nil {
+			playErr = err
+			return
+		}
+
+		defer f.Close()
+		play = &player{}
+		dec := json.NewDecoder(f)
+		for {
+			var it interaction
+			err := dec.Decode(&it)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				playErr = errors.Join(errors.New("replay: invalid cassette"), err)
+				return
+			}
+
+			play.items = append(play.items, &it)
+		}
+	})
+
+	return play, playErr
+}
+
+// next returns the first unused interaction of method with the same
+// request. Requests must match exactly, so time-based defaults (i.e. --start,
+// --end) must be set explicitly for replays on another day.
+func (p *player) next(method string, req json.RawMessage) (*interaction, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	var other bool
+	for _, it := range p.items {
+		if it.used || it.Method != method {
+			continue
+		}
+
+		if bytes.Equal(it.Request, req) {
+			it.used = true
+			return it, nil
+		}
+
+		other = true
+	}
+
+	if other {
+		return nil, status.Errorf(codes.Unimplemented, "replay: no recorded call for %v with request %s", method, req)
+	}
+
+	return nil, status.Errorf(codes.Unimplemented, "replay: no recorded call for %v", method)
+}
+
+func (p *player) unary(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+) error {
+	it, err := p.next(method, request(req))
+	if err != nil {
+		return err
+	}
+
+	for _, o := range opts {
+		switch o := o.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = it.Header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = it.Trailer
+		}
+	}
+
+	if err := it.err(); err != nil {
+		return err
+	}
+
+	if len(it.Responses) == 0 {
+		return status.Errorf(codes.Internal, "replay: no recorded response for %v", method)
+	}
+
+	return decode(it.Responses[0], reply)
+}
+
+func (p *player) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return &replayStream{ctx: ctx, method: method, player: p}, nil
+}
+
+// replayStream is a client stream that serves a recorded interaction. The
+// interaction is selected on the first RecvMsg, after the request is sent.
+type replayStream struct {
+	ctx    context.Context
+	method string
+	player *player
+	req    json.RawMessage
+	it     *interaction
+	n      int
+}
+
+func (s *replayStream) Header() (metadata.MD, error) {
+	if s.it == nil {
+		return nil, nil
+	}
+
+	return s.it.Header, nil
+}
+
+func (s *replayStream) Trailer() metadata.MD {
+	if s.it == nil {
+		return nil
+	}
+
+	return s.it.Trailer
+}
+
+func (s *replayStream) CloseSend() error         { return nil }
+func (s *replayStream) Context() context.Context { return s.ctx }
+
+func (s *replayStream) SendMsg(m any) error {
+	s.req = request(m)
+	return nil
+}
+
+func (s *replayStream) RecvMsg(m any) error {
+	if err := s.ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	if s.it == nil {
+		it, err := s.player.next(s.method, s.req)
+		if err != nil {
+			return err
+		}
+
+		s.it = it
+	}
+
+	if s.n < len(s.it.Responses) {
+		s.n++
+		return decode(s.it.Responses[s.n-1], m)
+	}
+
+	if err := s.it.err(); err != nil {
+		return err
+	}
+
+	return io.EOF
+}
@@ -0,0 +1,283 @@
+package grpcconn
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeStream is a client stream that returns msgs, then err (io.EOF if nil).
+type fakeStream struct {
+	grpc.ClientStream
+	msgs []string
+	err  error
+}
+
+func (s *fakeStream) Header() (metadata.MD, error) { return metadata.Pairs("k", "v"), nil }
+func (s *fakeStream) Trailer() metadata.MD         { return nil }
+func (s *fakeStream) SendMsg(m any) error          { return nil }
+func (s *fakeStream) CloseSend() error             { return nil }
+
+func (s *fakeStream) RecvMsg(m any) error {
+	if len(s.msgs) == 0 {
+		if s.err != nil {
+			return s.err
+		}
+
+		return io.EOF
+	}
+
+	proto.Merge(m.(proto.Message), wrapperspb.String(s.msgs[0]))
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func str(v string) json.RawMessage { return request(wrapperspb.String(v)) }
+
+func TestPlayerNext(t *testing.T) {
+	p := &player{items: []*interaction{
+		{Method: "/m1", Request: str("a"), Responses: []json.RawMessage{str("1")}},
+		{Method: "/m1", Request: str("b"), Responses: []json.RawMessage{str("2")}},
+		{Method: "/m1", Request: str("a"), Responses: []json.RawMessage{str("3")}},
+		{Method: "/m2", Request: str("a"), Responses: []json.RawMessage{str("4")}},
+	}}
+
+	for _, tc := range []struct {
+		method string
+		req    string
+		want   string // response, or error message
+	}{
+		{method: "/m1", req: "a", want: "1"},
+		{method: "/m1", req: "a", want: "3"}, // same request, in order
+		{method: "/m1", req: "a", want: `no recorded call for /m1 with request "a"`},
+		{method: "/m1", req: "b", want: "2"},
+		{method: "/m1", req: "b", want: "no recorded call for /m1"},
+		{method: "/m2", req: "b", want: `no recorded call for /m2 with request "b"`},
+		{method: "/m2", req: "a", want: "4"},
+		{method: "/m3", req: "a", want: "no recorded call for /m3"},
+	} {
+		it, err := p.next(tc.method, str(tc.req))
+		var got string
+		switch {
+		case err != nil:
+			if status.Code(err) != codes.Unimplemented {
+				t.Errorf("next(%v, %v): got code %v, want Unimplemented", tc.method, tc.req, status.Code(err))
+			}
+
+			got = strings.TrimPrefix(status.Convert(err).Message(), "replay: ")
+		default:
+			var v wrapperspb.StringValue
+			decode(it.Responses[0], &v)
+			got = v.Value
+		}
+
+		if got != tc.want {
+			t.Errorf("next(%v, %v) = %q, want %q", tc.method, tc.req, got, tc.want)
+		}
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	failed, _ := json.Marshal(map[string]any{"code": codes.NotFound, "message": "not found"})
+	p := &player{items: []*interaction{
+		{Method: "/unary", Request: str("a"), Responses: []json.RawMessage{str("1")}, Header: metadata.Pairs("k", "v")},
+		{Method: "/unary", Request: str("b"), Status: failed},
+		{Method: "/stream", Request: str("a"), Responses: []json.RawMessage{str("1"), str("2")}, Status: failed},
+	}}
+
+	ctx := context.Background()
+	var reply wrapperspb.StringValue
+	var hdr metadata.MD
+	err := p.unary(ctx, "/unary", wrapperspb.String("a"), &reply, nil, nil, grpc.Header(&hdr))
+	if err != nil || reply.Value != "1" || hdr.Get("k")[0] != "v" {
+		t.Errorf("unary: got %v, %v, %v", reply.Value, hdr, err)
+	}
+
+	err = p.unary(ctx, "/unary", wrapperspb.String("b"), &reply, nil, nil)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("unary: got %v, want the recorded status", err)
+	}
+
+	s, _ := p.stream(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/stream", nil)
+	s.SendMsg(wrapperspb.String("a"))
+	var got []string
+	for {
+		var v wrapperspb.StringValue
+		err = s.RecvMsg(&v)
+		if err != nil {
+			break
+		}
+
+		got = append(got, v.Value)
+	}
+
+	if strings.Join(got, ",") != "1,2" || status.Code(err) != codes.NotFound {
+		t.Errorf("stream: got %v, %v", got, err)
+	}
+}
+
+// readCassette returns the interactions in file.
+func readCassette(t *testing.T, file string) []*interaction {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []*interaction
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var it interaction
+		if err := json.Unmarshal([]byte(l), &it); err != nil {
+			t.Fatalf("invalid line %q: %v", l, err)
+		}
+
+		items = append(items, &it)
+	}
+
+	return items
+}
+
+func TestRecorder(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cassette.jsonl")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := rec
+	rec = &recorder{f: f, open: map[*recordStream]struct{}{}}
+	defer func() { rec = saved }()
+
+	ctx := context.Background()
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if req.(*wrapperspb.StringValue).Value == "fail" {
+			return status.Error(codes.PermissionDenied, "denied")
+		}
+
+		proto.Merge(reply.(proto.Message), wrapperspb.String("ok"))
+		return nil
+	}
+
+	var reply wrapperspb.StringValue
+	if err := rec.unary(ctx, "/unary", wrapperspb.String("a"), &reply, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	err = rec.unary(ctx, "/unary", wrapperspb.String("fail"), &reply, nil, invoker)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("got %v, want the call's error", err)
+	}
+
+	// A stream read until the end, and one abandoned after a message.
+	streamer := func(msgs ...string) grpc.Streamer {
+		return func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeStream{msgs: msgs}, nil
+		}
+	}
+
+	// Streams that fail to open are recorded with their request.
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	down := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	}
+
+	failed, _ := rec.stream(ctx, desc, nil, "/down", down)
+	if err := failed.SendMsg(wrapperspb.String("c")); status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, want the open error", err)
+	}
+
+	done, _ := rec.stream(ctx, desc, nil, "/done", streamer("1", "2"))
+	partial, _ := rec.stream(ctx, desc, nil, "/partial", streamer("1", "2"))
+	done.SendMsg(wrapperspb.String("a"))
+	partial.SendMsg(wrapperspb.String("b"))
+	partial.RecvMsg(&wrapperspb.StringValue{})
+	for done.RecvMsg(&wrapperspb.StringValue{}) == nil {
+	}
+
+	if err := FlushRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	items := readCassette(t, file)
+	var got []string
+	for _, it := range items {
+		s := it.Method + " " + string(it.Request)
+		for _, r := range it.Responses {
+			s += " " + string(r)
+		}
+
+		if err := it.err(); err != nil {
+			s += " " + status.Code(err).String()
+		}
+
+		got = append(got, s)
+	}
+
+	want := []string{
+		`/unary "a" "ok"`,
+		`/unary "fail" PermissionDenied`,
+		`/down "c" Unavailable`,
+		`/done "a" "1" "2"`,
+		`/partial "b" "1" Canceled`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRecorderWriteError(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "cassette.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close() // writes fail
+	saved := rec
+	rec = &recorder{f: f, open: map[*recordStream]struct{}{}}
+	defer func() { rec = saved }()
+
+	ctx := context.Background()
+	ok := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error { return nil }
+	failed := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		return status.Error(codes.NotFound, "not found")
+	}
+
+	var reply wrapperspb.StringValue
+	err = rec.unary(ctx, "/unary", wrapperspb.String("a"), &reply, nil, ok)
+	if err == nil || !strings.HasPrefix(err.Error(), "record: ") {
+		t.Errorf("got %v, want the write error", err)
+	}
+
+	// The call's error comes first.
+	err = rec.unary(ctx, "/unary", wrapperspb.String("a"), &reply, nil, failed)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("got %v, want the call's error", err)
+	}
+
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeStream{msgs: []string{"1"}}, nil
+	}
+
+	s, _ := rec.stream(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/stream", streamer)
+	s.RecvMsg(&wrapperspb.StringValue{})
+	err = s.RecvMsg(&wrapperspb.StringValue{})
+	if err == io.EOF || err == nil {
+		t.Errorf("stream: got %v, want the write error instead of EOF", err)
+	}
+
+	if err := FlushRecording(); err == nil {
+		t.Error("FlushRecording: expected the first write error")
+	}
+}
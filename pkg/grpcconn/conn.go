@@ -2,11 +2,24 @@ package grpcconn
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
 	"strings"
 
 	"github.com/alphauslabs/blue-sdk-go/conn"
-	"github.com/alphauslabs/blue-sdk-go/session"
 	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/env"
+	"github.com/alphauslabs/bluectl/pkg/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
@@ -22,21 +35,223 @@ const (
 	KvStoreService = "kvstore"
 )
 
+// targets maps API packages to their target services, for callers that only
+// have a method name (i.e. bluectl api). Others use bluesvc.
+var targets = map[string]string{
+	"blueapi.cost.v1":    CostService,
+	"blueapi.billing.v1": BillingService,
+	"blueapi.kvstore.v1": KvStoreService,
+	"blueapi.flow.v1":    "flow",
+	"blueapi.cover.v1":   "cover",
+	"blueapi.pricing.v1": "pricing",
+}
+
+// TargetService returns the target service for the API package pkg, i.e.
+// blueapi.cost.v1, for GetConnection.
+func TargetService(pkg string) string {
+	if v, ok := targets[pkg]; ok {
+		return v
+	}
+
+	return bluesvc
+}
+
+// Response header/trailer keys that may carry the server's request id.
+var requestIdKeys = []string{"x-request-id", "request-id"}
+
+func saveRequestId(mds ...metadata.MD) {
+	for _, md := range mds {
+		for _, k := range requestIdKeys {
+			if v := md.Get(k); len(v) > 0 {
+				cmderr.SetRequestId(v[0])
+				return
+			}
+		}
+	}
+}
+
+// requestIdStream saves the request id from the stream's header, or trailer
+// once the stream ends.
+type requestIdStream struct {
+	grpc.ClientStream
+}
+
+func (s *requestIdStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		hdr, _ := s.Header()
+		saveRequestId(hdr, s.Trailer())
+	}
+
+	return err
+}
+
+// loopback returns true if target (host:port, or a dns:/// URI) is this host.
+func loopback(target string) bool {
+	target = target[strings.LastIndex(target, "/")+1:]
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// TlsConfig returns the TLS configuration based on --insecure and --ca-cert.
+func TlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: params.Insecure}
+	if params.CaCert == "" {
+		return cfg, nil
+	}
+
+	b, err := os.ReadFile(params.CaCert)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no valid certificates in %v", params.CaCert)
+	}
+
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// GetConnection returns a connection to our target service. Same as the SDK's
+// default connection, except that access tokens come from our on-disk cache
+// instead of a new login for every call. The target can be overridden using
+// --endpoint, with --plaintext for servers without TLS.
 func GetConnection(ctx context.Context, svcname string) (*conn.GrpcClientConn, error) {
-	sess := session.New(
-		session.WithLoginUrl(params.AuthUrl),
-		session.WithClientId(params.ClientId),
-		session.WithClientSecret(params.ClientSecret),
-	)
+	e, err := env.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	// No credentials needed when replaying.
+	var src *auth.Source
+	if params.Replay == "" {
+		src, err = auth.Default()
+		if err != nil {
+			return nil, err
+		}
+
+		src.Plaintext = params.Plaintext || loopback(e.GrpcTarget)
+	}
+
+	var creds credentials.TransportCredentials
+	switch {
+	case params.Plaintext:
+		creds = insecure.NewCredentials()
+	default:
+		cfg, err := TlsConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		creds = credentials.NewTLS(cfg)
+	}
+
+	// Same metadata as the SDK's interceptors.
+	md := func(ctx context.Context) context.Context {
+		return metadata.AppendToOutgoingContext(ctx,
+			"service-name", svcname,
+			"x-agent", "blue-sdk-go",
+		)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context,
+			method string, req, reply any, cc *grpc.ClientConn,
+			invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+		) error {
+			var hdr, trl metadata.MD
+			opts = append(opts, grpc.Header(&hdr), grpc.Trailer(&trl))
+			err := invoker(md(ctx), method, req, reply, cc, opts...)
+			saveRequestId(hdr, trl)
+			return err
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context,
+			desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+			streamer grpc.Streamer, opts ...grpc.CallOption,
+		) (grpc.ClientStream, error) {
+			s, err := streamer(md(ctx), desc, cc, method, opts...)
+			if err != nil {
+				return nil, err
+			}
+
+			return &requestIdStream{s}, nil
+		}),
+	}
+
+	if telemetry.Enabled() {
+		opts = append(opts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	}
+
+	if Tracing() {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(traceUnary),
+			grpc.WithChainStreamInterceptor(traceStream),
+		)
+	}
+
+	// Inside tracing, so calls are logged the same when replaying, but
+	// outside reauth, so calls retried with a new token are recorded once,
+	// with their final outcome.
+	switch {
+	case params.Record != "":
+		r, err := getRecorder()
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(r.unary),
+			grpc.WithChainStreamInterceptor(r.stream),
+		)
+	case params.Replay != "":
+		p, err := getPlayer()
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(p.unary),
+			grpc.WithChainStreamInterceptor(p.stream),
+		)
+	case params.Cache:
+		scope := strings.Join([]string{e.GrpcTarget, params.AuthProfile, params.ClientId}, ",")
+		opts = append(opts, grpc.WithChainStreamInterceptor(cacheStream(scope)))
+	}
+
+	// Innermost, so only the calls to the server are retried.
+	if src != nil {
+		opts = append(opts,
+			grpc.WithPerRPCCredentials(src),
+			grpc.WithChainUnaryInterceptor(reauthUnary(src)),
+			grpc.WithChainStreamInterceptor(reauthStream(src)),
+		)
+	}
+
+	gc, err := grpc.NewClient(e.GrpcTarget, opts...)
 
-	tgt := conn.BlueEndpoint
-	if strings.Contains(params.AuthUrl, "next") {
-		tgt = conn.BlueEndpointNext
+	if err != nil {
+		return nil, err
 	}
 
 	return conn.New(ctx,
-		conn.WithSession(sess),
-		conn.WithTarget(tgt),
+		conn.WithTarget(e.GrpcTarget),
 		conn.WithTargetService(svcname),
+		conn.WithGrpcConnection(gc),
 	)
 }
@@ -0,0 +1,21 @@
+package grpcconn
+
+import "testing"
+
+func TestLoopback(t *testing.T) {
+	for target, want := range map[string]bool{
+		"localhost:8080":                true,
+		"127.0.0.1:8080":                true,
+		"[::1]:8080":                    true,
+		"dns:///localhost:8080":         true,
+		"127.0.0.1":                     true,
+		"blue.alphaus.cloud:443":        false,
+		"dns:///blue.alphaus.cloud:443": false,
+		"10.0.0.1:8080":                 false,
+		"localhost.example.com:8080":    false,
+	} {
+		if got := loopback(target); got != want {
+			t.Errorf("loopback(%v) = %v, want %v", target, got, want)
+		}
+	}
+}
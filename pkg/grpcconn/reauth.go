@@ -0,0 +1,118 @@
+package grpcconn
+
+import (
+	"context"
+
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reauthUnary retries calls once with a new token when the server rejects
+// ours, i.e. a cached token that was revoked, or issued for a rotated secret.
+func reauthUnary(src *auth.Source) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+	) error {
+		tok, _ := src.Token() // what the call sends; errors are the call's
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated || ctx.Err() != nil {
+			return err
+		}
+
+		reauthLog(method, err)
+		src.InvalidateToken(tok)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// reauthStream is reauthUnary for server streams. Servers usually reject the
+// token on the first receive, so the stream is re-opened then, and the sent
+// request is sent again. Client streams are not retried.
+func reauthStream(src *auth.Source) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		open := func() (grpc.ClientStream, error) { return streamer(ctx, desc, cc, method, opts...) }
+		tok, _ := src.Token()
+		s, err := open()
+		if status.Code(err) == codes.Unauthenticated && ctx.Err() == nil {
+			reauthLog(method, err)
+			src.InvalidateToken(tok)
+			s, err = open()
+		}
+
+		if err != nil || desc.ClientStreams {
+			return s, err
+		}
+
+		return &reauthClientStream{ClientStream: s, ctx: ctx, method: method, src: src, tok: tok, open: open}, nil
+	}
+}
+
+type reauthClientStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	method string
+	src    *auth.Source
+	tok    string // the token sent when opened
+	open   func() (grpc.ClientStream, error)
+
+	sent    []any // the request(s), to send again
+	closed  bool  // CloseSend was called
+	recvd   bool  // at least one message was received
+	retried bool
+}
+
+func (s *reauthClientStream) SendMsg(m any) error {
+	s.sent = append(s.sent, m)
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *reauthClientStream) CloseSend() error {
+	s.closed = true
+	return s.ClientStream.CloseSend()
+}
+
+func (s *reauthClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.recvd = true
+		return nil
+	case s.recvd || s.retried || status.Code(err) != codes.Unauthenticated || s.ctx.Err() != nil:
+		return err
+	}
+
+	s.retried = true
+	reauthLog(s.method, err)
+	s.src.InvalidateToken(s.tok)
+	cs, e := s.open()
+	if e != nil {
+		return e
+	}
+
+	for _, v := range s.sent {
+		if e := cs.SendMsg(v); e != nil {
+			return e
+		}
+	}
+
+	if s.closed {
+		if e := cs.CloseSend(); e != nil {
+			return e
+		}
+	}
+
+	s.ClientStream = cs
+	err = cs.RecvMsg(m)
+	s.recvd = err == nil
+	return err
+}
+
+func reauthLog(method string, err error) {
+	if Tracing() {
+		tracelog.Printf("    %v: %v, retrying with a new token", method, status.Convert(err).Message())
+	}
+}
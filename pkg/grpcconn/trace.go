@@ -0,0 +1,230 @@
+package grpcconn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alphauslabs/bluectl/params"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const redacted = "REDACTED"
+
+// tracelog writes our --verbose/--trace logs to stderr, so they never mix
+// with the command's output.
+var tracelog = log.New(os.Stderr, "", log.LstdFlags|log.Lmicroseconds)
+
+// Sensitive metadata keys and payload field names (lowercase substrings).
+var secretKeys = []string{
+	"authorization",
+	"cookie",
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"apikey",
+	"api-key",
+	"credential",
+}
+
+func isSecret(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tracing returns true if --verbose or --trace is set.
+func Tracing() bool { return params.Verbose || params.Trace }
+
+// redactMd returns md in JSON, with secrets redacted.
+func redactMd(md metadata.MD) string {
+	out := map[string][]string{}
+	for k, v := range md {
+		switch {
+		case isSecret(k):
+			out[k] = []string{redacted}
+		default:
+			out[k] = v
+		}
+	}
+
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+// redactMsg returns m in JSON, with secret fields redacted.
+func redactMsg(m any) string {
+	b, err := redactedJson(m)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(b)
+}
+
+// redactedJson returns the JSON encoding of the proto message m, with
+// secret fields redacted. Keys are sorted, so the output is stable.
+func redactedJson(m any) ([]byte, error) {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto message", m)
+	}
+
+	b, err := protojson.Marshal(pm)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(redactJson(v))
+}
+
+func redactJson(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, vv := range t {
+			switch {
+			case isSecret(k):
+				t[k] = redacted
+			default:
+				t[k] = redactJson(vv)
+			}
+		}
+	case []any:
+		for i := range t {
+			t[i] = redactJson(t[i])
+		}
+	}
+
+	return v
+}
+
+func traceSend(ctx context.Context, method string, req any) {
+	tracelog.Printf("--> %v", method)
+	if !params.Trace {
+		return
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	tracelog.Printf("    metadata: %v", redactMd(md))
+	if req != nil {
+		tracelog.Printf("    request: %v", redactMsg(req))
+	}
+}
+
+func traceDone(method string, begin time.Time, msgs int, err error, hdr, trl metadata.MD) {
+	tracelog.Printf("<-- %v %v %v, %v message(s)", method,
+		status.Code(err), time.Since(begin).Round(time.Microsecond), msgs)
+
+	if err != nil {
+		tracelog.Printf("    error: %v", status.Convert(err).Message())
+	}
+
+	if !params.Trace {
+		return
+	}
+
+	if len(hdr) > 0 {
+		tracelog.Printf("    header: %v", redactMd(hdr))
+	}
+
+	if len(trl) > 0 {
+		tracelog.Printf("    trailer: %v", redactMd(trl))
+	}
+}
+
+func traceUnary(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+) error {
+	var hdr, trl metadata.MD
+	opts = append(opts, grpc.Header(&hdr), grpc.Trailer(&trl))
+	begin := time.Now()
+	traceSend(ctx, method, req)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	var msgs int
+	if err == nil {
+		msgs = 1
+		if params.Trace {
+			tracelog.Printf("    response: %v", redactMsg(reply))
+		}
+	}
+
+	traceDone(method, begin, msgs, err, hdr, trl)
+	return err
+}
+
+func traceStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	begin := time.Now()
+	traceSend(ctx, method, nil) // request is sent via SendMsg
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		traceDone(method, begin, 0, err, nil, nil)
+		return nil, err
+	}
+
+	return &traceClientStream{ClientStream: s, method: method, begin: begin}, nil
+}
+
+// traceClientStream logs the messages of a client stream, and the status
+// once the stream ends.
+type traceClientStream struct {
+	grpc.ClientStream
+	method string
+	begin  time.Time
+	msgs   int
+	once   sync.Once
+}
+
+func (s *traceClientStream) SendMsg(m any) error {
+	if params.Trace {
+		tracelog.Printf("    request: %v", redactMsg(m))
+	}
+
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *traceClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.msgs++
+		if params.Trace {
+			tracelog.Printf("    response #%v: %v", s.msgs, redactMsg(m))
+		}
+
+		return nil
+	}
+
+	s.once.Do(func() {
+		var e error
+		if err != io.EOF {
+			e = err
+		}
+
+		hdr, _ := s.Header()
+		traceDone(s.method, s.begin, s.msgs, e, hdr, s.Trailer())
+	})
+
+	return err
+}
@@ -0,0 +1,522 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alphauslabs/blue-sdk-go/admin/v1"
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/blue-sdk-go/iam/v1"
+	"github.com/alphauslabs/bluectl/pkg/grpcconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// Supported kinds.
+const (
+	KindNotificationChannel = "NotificationChannel"
+	KindIdentityProvider    = "IdentityProvider"
+	KindIpFilter            = "IpFilter"
+	KindCostModifier        = "CostModifier"
+	KindCalculationSchedule = "CalculationSchedule"
+)
+
+// order is the order in which kinds are created and updated; deletes are in
+// reverse. Schedules can refer to notification channels.
+var order = []string{
+	KindNotificationChannel,
+	KindIdentityProvider,
+	KindIpFilter,
+	KindCostModifier,
+	KindCalculationSchedule,
+}
+
+// kind describes how to reconcile a resource type.
+type kind struct {
+	// Returns a new, empty spec message.
+	new func() proto.Message
+
+	// Returns the identity of spec, i.e. its name. Kinds without names use
+	// the whole spec, so changes are a delete and a create.
+	key func(spec proto.Message) string
+
+	// Optional. Short description of spec; defaults to key.
+	title func(spec proto.Message) string
+
+	// Optional. Applies defaults to specs, both desired and current.
+	normalize func(spec proto.Message)
+
+	// Optional. Copies fields the API sets from current to desired, so they
+	// don't show up as changes.
+	merge func(desired, current proto.Message)
+
+	// Optional. Clears the fields of desired that can't be compared with
+	// current, i.e. write-only fields the API doesn't return, and returns
+	// their names. Only used for comparisons; changes still send them.
+	writeOnly func(desired, current proto.Message) []string
+
+	list   func(ctx context.Context, c *Clients) ([]*Object, error)
+	create func(ctx context.Context, c *Clients, spec proto.Message) error
+	delete func(ctx context.Context, c *Clients, id string) error
+
+	// Optional. If nil, changes are applied as a create and a delete.
+	update func(ctx context.Context, c *Clients, id string, spec proto.Message) error
+
+	// If true, the API doesn't allow two objects with the same key, so
+	// replaces delete the current object before creating the new one.
+	exclusive bool
+}
+
+// Kinds returns the supported kinds.
+func Kinds() []string { return append([]string{}, order...) }
+
+// contentKey is the key of kinds without names.
+func contentKey(spec proto.Message) string {
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(spec)
+	return string(b)
+}
+
+var kinds = map[string]*kind{
+	KindNotificationChannel: {
+		new: func() proto.Message { return &admin.CreateNotificationChannelRequest{} },
+		key: func(spec proto.Message) string {
+			return spec.(*admin.CreateNotificationChannelRequest).Name
+		},
+		list: func(ctx context.Context, c *Clients) ([]*Object, error) {
+			client, err := c.Admin(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := client.ListNotificationChannels(ctx, &admin.ListNotificationChannelsRequest{})
+			if err != nil {
+				return nil, err
+			}
+
+			var objs []*Object
+			for _, v := range resp.Channels {
+				objs = append(objs, &Object{
+					Kind: KindNotificationChannel,
+					Id:   v.Id,
+					Spec: &admin.CreateNotificationChannelRequest{
+						Name:    v.Name,
+						Type:    v.Type,
+						Email:   v.Email,
+						Slack:   v.Slack,
+						Msteams: v.Msteams,
+						Product: v.Product,
+					},
+				})
+			}
+
+			return objs, nil
+		},
+		create: func(ctx context.Context, c *Clients, spec proto.Message) error {
+			client, err := c.Admin(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.CreateNotificationChannel(ctx, spec.(*admin.CreateNotificationChannelRequest))
+			return err
+		},
+		update: func(ctx context.Context, c *Clients, id string, spec proto.Message) error {
+			client, err := c.Admin(ctx)
+			if err != nil {
+				return err
+			}
+
+			v := spec.(*admin.CreateNotificationChannelRequest)
+			_, err = client.UpdateNotificationChannel(ctx, &admin.UpdateNotificationChannelRequest{
+				Id:      id,
+				Name:    v.Name,
+				Type:    v.Type,
+				Email:   v.Email,
+				Slack:   v.Slack,
+				Msteams: v.Msteams,
+				Product: v.Product,
+			})
+
+			return err
+		},
+		delete: func(ctx context.Context, c *Clients, id string) error {
+			client, err := c.Admin(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.DeleteNotificationChannel(ctx, &admin.DeleteNotificationChannelRequest{Id: id})
+			return err
+		},
+	},
+	KindIdentityProvider: {
+		new: func() proto.Message { return &iam.CreateIdentityProviderRequest{} },
+		key: func(spec proto.Message) string {
+			return spec.(*iam.CreateIdentityProviderRequest).Name
+		},
+		normalize: func(spec proto.Message) {
+			v := spec.(*iam.CreateIdentityProviderRequest)
+			if v.Type == "" {
+				v.Type = "saml"
+			}
+
+			v.Metadata = strings.TrimSpace(v.Metadata)
+		},
+		writeOnly: func(desired, current proto.Message) []string {
+			// Metadata is write-only in some environments.
+			v := desired.(*iam.CreateIdentityProviderRequest)
+			if current.(*iam.CreateIdentityProviderRequest).Metadata != "" || v.Metadata == "" {
+				return nil
+			}
+
+			v.Metadata = ""
+			return []string{"metadata"}
+		},
+		list: func(ctx context.Context, c *Clients) ([]*Object, error) {
+			client, err := c.Iam(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := client.ListIdentityProviders(ctx, &iam.ListIdentityProvidersRequest{})
+			if err != nil {
+				return nil, err
+			}
+
+			var objs []*Object
+			for _, d := range resp.Data {
+				objs = append(objs, &Object{
+					Kind: KindIdentityProvider,
+					Id:   d.Id,
+					Spec: &iam.CreateIdentityProviderRequest{
+						Name:     d.Name,
+						Type:     d.Type,
+						Metadata: d.Saml.GetMetadata(),
+					},
+				})
+			}
+
+			return objs, nil
+		},
+		create: func(ctx context.Context, c *Clients, spec proto.Message) error {
+			client, err := c.Iam(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.CreateIdentityProvider(ctx, spec.(*iam.CreateIdentityProviderRequest))
+			return err
+		},
+		delete: func(ctx context.Context, c *Clients, id string) error {
+			client, err := c.Iam(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.DeleteIdentityProvider(ctx, &iam.DeleteIdentityProviderRequest{Id: id})
+			return err
+		},
+	},
+	KindIpFilter: {
+		new: func() proto.Message { return &iam.CreateIpFilterRequest{} },
+		key: contentKey,
+		title: func(spec proto.Message) string {
+			v := spec.(*iam.CreateIpFilterRequest)
+			switch {
+			case v.SubUser != "":
+				return fmt.Sprintf("%v %v (subuser %v/%v)", v.Type, v.Value, v.RootUser, v.SubUser)
+			case v.RootUser != "":
+				return fmt.Sprintf("%v %v (rootuser %v)", v.Type, v.Value, v.RootUser)
+			default:
+				return fmt.Sprintf("%v %v (global)", v.Type, v.Value)
+			}
+		},
+		normalize: func(spec proto.Message) {
+			v := spec.(*iam.CreateIpFilterRequest)
+			if v.Type == "" {
+				v.Type = "blacklist"
+			}
+		},
+		list: func(ctx context.Context, c *Clients) ([]*Object, error) {
+			client, err := c.Iam(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			stream, err := client.ListIpFilters(ctx, &iam.ListIpFiltersRequest{})
+			if err != nil {
+				return nil, err
+			}
+
+			var objs []*Object
+			for {
+				v, err := stream.Recv()
+				if err == io.EOF {
+					return objs, nil
+				}
+
+				if err != nil {
+					return nil, err
+				}
+
+				spec := &iam.CreateIpFilterRequest{Type: v.Type, Value: v.Value}
+				switch v.Scope {
+				case "rootuser":
+					spec.RootUser = v.Target
+				case "subuser":
+					spec.RootUser, spec.SubUser, _ = strings.Cut(v.Target, "/")
+					if spec.SubUser == "" {
+						spec.RootUser, spec.SubUser = "", spec.RootUser
+					}
+				}
+
+				objs = append(objs, &Object{Kind: KindIpFilter, Id: v.Id, Spec: spec})
+			}
+		},
+		create: func(ctx context.Context, c *Clients, spec proto.Message) error {
+			client, err := c.Iam(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.CreateIpFilter(ctx, spec.(*iam.CreateIpFilterRequest))
+			return err
+		},
+		delete: func(ctx context.Context, c *Clients, id string) error {
+			client, err := c.Iam(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.DeleteIpFilter(ctx, &iam.DeleteIpFilterRequest{Id: id})
+			return err
+		},
+	},
+	KindCostModifier: {
+		new: func() proto.Message { return &cost.CalculatorCostModifierAwsOptions{} },
+		key: contentKey,
+		title: func(spec proto.Message) string {
+			v := spec.(*cost.CalculatorCostModifierAwsOptions)
+			var s []string
+			for _, f := range []struct{ k, v string }{
+				{"payer", v.PayerId},
+				{"account", v.AccountId},
+				{"group", v.GroupId},
+				{"formula", v.Modifier.GetFormula()},
+			} {
+				if f.v != "" {
+					s = append(s, f.k+"="+f.v)
+				}
+			}
+
+			return strings.Join(s, " ")
+		},
+		list: func(ctx context.Context, c *Clients) ([]*Object, error) {
+			client, err := c.Cost(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			stream, err := client.ListCalculatorCostModifiers(ctx, &cost.ListCalculatorCostModifiersRequest{
+				Vendor: "aws",
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			var objs []*Object
+			for {
+				v, err := stream.Recv()
+				if err == io.EOF {
+					return objs, nil
+				}
+
+				if err != nil {
+					return nil, err
+				}
+
+				if v.AwsOptions != nil {
+					objs = append(objs, &Object{Kind: KindCostModifier, Id: v.Id, Spec: v.AwsOptions})
+				}
+			}
+		},
+		create: func(ctx context.Context, c *Clients, spec proto.Message) error {
+			client, err := c.Cost(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.CreateCalculatorCostModifier(ctx, &cost.CreateCalculatorCostModifierRequest{
+				Vendor:     "aws",
+				AwsOptions: spec.(*cost.CalculatorCostModifierAwsOptions),
+			})
+
+			return err
+		},
+		delete: func(ctx context.Context, c *Clients, id string) error {
+			client, err := c.Cost(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.DeleteCalculatorCostModifier(ctx, &cost.DeleteCalculatorCostModifierRequest{
+				Vendor: "aws",
+				Id:     id,
+			})
+
+			return err
+		},
+	},
+	KindCalculationSchedule: {
+		new: func() proto.Message { return &cost.CreateCalculationsScheduleRequest{} },
+		key: func(proto.Message) string {
+			return "default" // only one schedule per account at the moment
+		},
+		exclusive: true,
+		title: func(spec proto.Message) string {
+			v := spec.(*cost.CreateCalculationsScheduleRequest)
+			if v.ScheduleMacro != "" {
+				return v.ScheduleMacro
+			}
+
+			return v.Schedule
+		},
+		normalize: func(spec proto.Message) {
+			v := spec.(*cost.CreateCalculationsScheduleRequest)
+			v.Vendor = ""
+			v.Force = false
+		},
+		merge: func(desired, current proto.Message) {
+			// If not set, the API creates a channel using your email.
+			d := desired.(*cost.CreateCalculationsScheduleRequest)
+			if d.NotificationChannel == "" {
+				d.NotificationChannel = current.(*cost.CreateCalculationsScheduleRequest).NotificationChannel
+			}
+		},
+		list: func(ctx context.Context, c *Clients) ([]*Object, error) {
+			client, err := c.Cost(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := client.ListCalculationsSchedules(ctx, &cost.ListCalculationsSchedulesRequest{Vendor: "aws"})
+			if err != nil {
+				return nil, err
+			}
+
+			var objs []*Object
+			for _, v := range resp.Schedules {
+				objs = append(objs, &Object{
+					Kind: KindCalculationSchedule,
+					Id:   v.Id,
+					Spec: &cost.CreateCalculationsScheduleRequest{
+						Schedule:            v.Schedule,
+						ScheduleMacro:       v.ScheduleMacro,
+						TargetMonth:         v.TargetMonth,
+						NotificationChannel: v.NotificationChannel,
+						DryRun:              v.DryRun,
+					},
+				})
+			}
+
+			return objs, nil
+		},
+		create: func(ctx context.Context, c *Clients, spec proto.Message) error {
+			client, err := c.Cost(ctx)
+			if err != nil {
+				return err
+			}
+
+			in := proto.Clone(spec).(*cost.CreateCalculationsScheduleRequest)
+			in.Vendor = "aws"
+			in.Force = true
+			_, err = client.CreateCalculationsSchedule(ctx, in)
+			return err
+		},
+		delete: func(ctx context.Context, c *Clients, id string) error {
+			client, err := c.Cost(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = client.DeleteCalculationsSchedule(ctx, &cost.DeleteCalculationsScheduleRequest{
+				Vendor: "aws",
+				Id:     id,
+			})
+
+			return err
+		},
+	},
+}
+
+// Clients are the API clients used by the kinds, created on first use.
+type Clients struct {
+	admin *admin.GrpcClient
+	iam   *iam.GrpcClient
+	cost  *cost.GrpcClient
+}
+
+func (c *Clients) Admin(ctx context.Context) (*admin.GrpcClient, error) {
+	if c.admin == nil {
+		con, err := grpcconn.GetConnection(ctx, grpcconn.AdminService)
+		if err != nil {
+			return nil, err
+		}
+
+		c.admin, err = admin.NewClient(ctx, &admin.ClientOptions{Conn: con})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.admin, nil
+}
+
+func (c *Clients) Iam(ctx context.Context) (*iam.GrpcClient, error) {
+	if c.iam == nil {
+		con, err := grpcconn.GetConnection(ctx, grpcconn.IamService)
+		if err != nil {
+			return nil, err
+		}
+
+		c.iam, err = iam.NewClient(ctx, &iam.ClientOptions{Conn: con})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.iam, nil
+}
+
+func (c *Clients) Cost(ctx context.Context) (*cost.GrpcClient, error) {
+	if c.cost == nil {
+		con, err := grpcconn.GetConnection(ctx, grpcconn.CostService)
+		if err != nil {
+			return nil, err
+		}
+
+		c.cost, err = cost.NewClient(ctx, &cost.ClientOptions{Conn: con})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.cost, nil
+}
+
+// Close closes the clients that were used.
+func (c *Clients) Close() {
+	if c.admin != nil {
+		c.admin.Close()
+	}
+
+	if c.iam != nil {
+		c.iam.Close()
+	}
+
+	if c.cost != nil {
+		c.cost.Close()
+	}
+}
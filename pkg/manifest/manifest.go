@@ -0,0 +1,262 @@
+// Package manifest is our declarative format for configuration resources
+// (bluectl apply, diff, export): a YAML stream of documents, each with a kind
+// and a spec in the same format as --raw-input (camelCase field names).
+//
+//	kind: NotificationChannel
+//	spec:
+//	  name: finance
+//	  type: email
+//	  email:
+//	    recipients: [finance@example.com]
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alphauslabs/bluectl/pkg/rawinput"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// Object is a resource, either from a manifest (desired) or from the API
+// (current). Id is only set for the latter.
+type Object struct {
+	Kind string
+	Id   string
+	Spec proto.Message
+}
+
+// Key returns the identity of o within its kind.
+func (o *Object) Key() string { return kinds[o.Kind].key(o.Spec) }
+
+// Title returns a short description of o, for logs and diffs.
+func (o *Object) Title() string {
+	k := kinds[o.Kind]
+	if k.title != nil {
+		return k.title(o.Spec)
+	}
+
+	return k.key(o.Spec)
+}
+
+// Read parses the manifests in files. A file can be "-" (stdin), or a
+// directory, in which case all its *.yaml and *.yml files are read.
+func Read(files []string) ([]*Object, error) {
+	var objs []*Object
+	for _, f := range files {
+		var names []string
+		fi, err := os.Stat(f)
+		switch {
+		case f == "-":
+			names = []string{f}
+		case err != nil:
+			return nil, err
+		case fi.IsDir():
+			for _, p := range []string{"*.yaml", "*.yml"} {
+				m, _ := filepath.Glob(filepath.Join(f, p))
+				names = append(names, m...)
+			}
+
+			sort.Strings(names)
+		default:
+			names = []string{f}
+		}
+
+		for _, name := range names {
+			o, err := readFile(name)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+
+			objs = append(objs, o...)
+		}
+	}
+
+	return objs, nil
+}
+
+func readFile(name string) ([]*Object, error) {
+	if name == "-" {
+		return Decode(os.Stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return Decode(f)
+}
+
+// Decode parses a YAML stream of manifest documents. Empty documents are
+// skipped.
+func Decode(r io.Reader) ([]*Object, error) {
+	var objs []*Object
+	dec := yaml.NewDecoder(r)
+	for i := 1; ; i++ {
+		var doc map[any]any
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return objs, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("document %v: %w", i, err)
+		}
+
+		if len(doc) == 0 {
+			continue
+		}
+
+		o, err := decodeDoc(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %v: %w", i, err)
+		}
+
+		objs = append(objs, o)
+	}
+}
+
+func decodeDoc(doc map[any]any) (*Object, error) {
+	for k := range doc {
+		switch k {
+		case "kind", "spec":
+		default:
+			return nil, fmt.Errorf("unknown field %q, expected kind and spec", k)
+		}
+	}
+
+	name, _ := doc["kind"].(string)
+	k, ok := kinds[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid kind %q, valid kinds: %v", name, strings.Join(Kinds(), ", "))
+	}
+
+	b := []byte("{}")
+	if doc["spec"] != nil {
+		var err error
+		b, err = json.Marshal(rawinput.JsonValue(doc["spec"]))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+	}
+
+	spec := k.new()
+	err := protojson.Unmarshal(b, spec)
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid spec: %w", name, err)
+	}
+
+	if k.normalize != nil {
+		k.normalize(spec)
+	}
+
+	return &Object{Kind: name, Spec: spec}, nil
+}
+
+// specYaml returns the spec of o in YAML, with fields in proto order.
+func specYaml(o *Object) (yaml.MapSlice, error) {
+	b, err := protojson.Marshal(o.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms yaml.MapSlice
+	err = yaml.Unmarshal(b, &ms)
+	return ms, err
+}
+
+// Encode writes objs as a YAML stream of manifest documents.
+func Encode(w io.Writer, objs []*Object) error {
+	for i, o := range objs {
+		spec, err := specYaml(o)
+		if err != nil {
+			return err
+		}
+
+		b, err := yaml.Marshal(yaml.MapSlice{
+			{Key: "kind", Value: o.Kind},
+			{Key: "spec", Value: spec},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			io.WriteString(w, "---\n")
+		}
+
+		_, err = w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Diff returns the line diff of the specs of from and to (either can be nil),
+// in YAML, with "-" and "+" prefixes for removed and added lines.
+func Diff(from, to *Object) string {
+	lines := func(o *Object) []string {
+		if o == nil {
+			return nil
+		}
+
+		ms, err := specYaml(o)
+		if err != nil {
+			return []string{err.Error()}
+		}
+
+		b, _ := yaml.Marshal(ms)
+		return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+
+	a, b := lines(from), lines(to)
+
+	// Longest common subsequence; specs are small.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			default:
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&out, "  %v\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&out, "- %v\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&out, "+ %v\n", b[j])
+			j++
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,231 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Change operations.
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpReplace = "replace" // create then delete, for kinds without updates
+	OpDelete  = "delete"
+)
+
+// Change is a single step to go from the current to the desired state.
+// From is nil for creates, To is nil for deletes.
+type Change struct {
+	Op   string
+	Kind string
+	From *Object
+	To   *Object
+
+	// For deletes, the id of the object with the same key that is kept, if
+	// From is a duplicate.
+	DuplicateOf string
+}
+
+// Title returns a short description of the changed object.
+func (c *Change) Title() string {
+	if c.To != nil {
+		return c.To.Title()
+	}
+
+	if c.DuplicateOf != "" {
+		return fmt.Sprintf("%v (duplicate of %v)", c.From.Title(), c.DuplicateOf)
+	}
+
+	return c.From.Title()
+}
+
+// Destructive returns true if c deletes a current object.
+func (c *Change) Destructive() bool { return c.Op == OpDelete || c.Op == OpReplace }
+
+// Export returns the current objects of kinds (all kinds if empty), in apply
+// order.
+func Export(ctx context.Context, c *Clients, names ...string) ([]*Object, error) {
+	if len(names) == 0 {
+		names = order
+	}
+
+	want := map[string]bool{}
+	for _, n := range names {
+		if _, ok := kinds[n]; !ok {
+			return nil, fmt.Errorf("invalid kind %q, valid kinds: %v", n, Kinds())
+		}
+
+		want[n] = true
+	}
+
+	var objs []*Object
+	for _, n := range order {
+		if !want[n] {
+			continue
+		}
+
+		o, err := current(ctx, c, n)
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, o...)
+	}
+
+	return objs, nil
+}
+
+func current(ctx context.Context, c *Clients, name string) ([]*Object, error) {
+	k := kinds[name]
+	objs, err := k.list(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("list %v: %w", name, err)
+	}
+
+	if k.normalize != nil {
+		for _, o := range objs {
+			k.normalize(o.Spec)
+		}
+	}
+
+	return objs, nil
+}
+
+// Plan returns the changes needed to go from the current state to desired.
+// Only the kinds present in desired are considered; with prune, objects of
+// those kinds that are not in desired are deleted. Current objects with the
+// same key are compared against the first one; with prune, the others are
+// deleted with DuplicateOf set. Objects in desired are not modified. The
+// returned warnings list the desired fields that couldn't be compared, so
+// changes to them alone are not detected.
+func Plan(ctx context.Context, c *Clients, desired []*Object, prune bool) ([]*Change, []string, error) {
+	byKind := map[string][]*Object{}
+	seen := map[string]bool{}
+	for _, o := range desired {
+		id := o.Kind + "/" + o.Key()
+		if seen[id] {
+			return nil, nil, fmt.Errorf("duplicate %v: %v", o.Kind, o.Title())
+		}
+
+		seen[id] = true
+		byKind[o.Kind] = append(byKind[o.Kind], o)
+	}
+
+	var changes, deletes []*Change
+	var warnings []string
+	for _, name := range order {
+		if _, ok := byKind[name]; !ok {
+			continue
+		}
+
+		k := kinds[name]
+		objs, err := current(ctx, c, name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		actual := map[string]*Object{}
+		matched := map[*Object]bool{}
+		for _, o := range objs {
+			if _, ok := actual[o.Key()]; !ok {
+				actual[o.Key()] = o
+			}
+		}
+
+		for _, o := range byKind[name] {
+			cur, ok := actual[o.Key()]
+			if !ok {
+				changes = append(changes, &Change{Op: OpCreate, Kind: name, To: o})
+				continue
+			}
+
+			matched[cur] = true
+			o = &Object{Kind: o.Kind, Id: cur.Id, Spec: proto.Clone(o.Spec)}
+			if k.merge != nil {
+				k.merge(o.Spec, cur.Spec)
+			}
+
+			cmp := o.Spec
+			if k.writeOnly != nil {
+				cmp = proto.Clone(o.Spec)
+				for _, f := range k.writeOnly(cmp, cur.Spec) {
+					warnings = append(warnings, fmt.Sprintf("%v %v: %v is not returned by the API, changes to it alone are not detected", name, o.Title(), f))
+				}
+			}
+
+			if proto.Equal(cmp, cur.Spec) {
+				continue
+			}
+
+			op := OpUpdate
+			if k.update == nil {
+				op = OpReplace
+			}
+
+			changes = append(changes, &Change{Op: op, Kind: name, From: cur, To: o})
+		}
+
+		if !prune {
+			continue
+		}
+
+		var dk []*Change
+		for _, o := range objs {
+			if matched[o] {
+				continue
+			}
+
+			ch := &Change{Op: OpDelete, Kind: name, From: o}
+			if first := actual[o.Key()]; first != o && matched[first] {
+				ch.DuplicateOf = first.Id
+			}
+
+			dk = append(dk, ch)
+		}
+
+		deletes = append(dk, deletes...)
+	}
+
+	return append(changes, deletes...), warnings, nil
+}
+
+// Apply makes a single change. Replaces create the new object first, so a
+// failure leaves the current one, except for exclusive kinds.
+func Apply(ctx context.Context, c *Clients, ch *Change) error {
+	k := kinds[ch.Kind]
+	var err error
+	switch {
+	case ch.Op == OpCreate:
+		err = k.create(ctx, c, ch.To.Spec)
+	case ch.Op == OpUpdate:
+		err = k.update(ctx, c, ch.From.Id, ch.To.Spec)
+	case ch.Op == OpReplace && k.exclusive:
+		err = k.delete(ctx, c, ch.From.Id)
+		if err == nil {
+			err = k.create(ctx, c, ch.To.Spec)
+			if err != nil {
+				err = fmt.Errorf("deleted %v, but create failed: %w", ch.From.Id, err)
+			}
+		}
+	case ch.Op == OpReplace:
+		err = k.create(ctx, c, ch.To.Spec)
+		if err == nil {
+			err = k.delete(ctx, c, ch.From.Id)
+			if err != nil {
+				err = fmt.Errorf("created, but delete of %v failed: %w", ch.From.Id, err)
+			}
+		}
+	case ch.Op == OpDelete:
+		err = k.delete(ctx, c, ch.From.Id)
+	default:
+		err = fmt.Errorf("invalid operation %q", ch.Op)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%v %v %v: %w", ch.Op, ch.Kind, ch.Title(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alphauslabs/blue-sdk-go/admin/v1"
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/blue-sdk-go/iam/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeApi is an in-memory API for all kinds, see useFake.
+type fakeApi struct {
+	objs   map[string][]*Object // current objects, per kind
+	listed []string             // kinds listed
+	calls  []string             // i.e. "create NotificationChannel finance"
+	fail   string               // calls that start with fail return an error
+	nextId int
+}
+
+func (f *fakeApi) call(s string) error {
+	f.calls = append(f.calls, s)
+	if f.fail != "" && strings.HasPrefix(s, f.fail) {
+		return errors.New("failed")
+	}
+
+	return nil
+}
+
+// useFake replaces the API calls of all kinds with f, for the duration of
+// the test.
+func useFake(t *testing.T, f *fakeApi) {
+	saved := kinds
+	t.Cleanup(func() { kinds = saved })
+	kinds = map[string]*kind{}
+	for name, k := range saved {
+		fk := *k
+		fk.list = func(ctx context.Context, c *Clients) ([]*Object, error) {
+			f.listed = append(f.listed, name)
+			var objs []*Object
+			for _, o := range f.objs[name] {
+				objs = append(objs, &Object{Kind: o.Kind, Id: o.Id, Spec: proto.Clone(o.Spec)})
+			}
+
+			return objs, nil
+		}
+
+		fk.create = func(ctx context.Context, c *Clients, spec proto.Message) error {
+			return f.call(fmt.Sprintf("create %v %v", name, k.key(spec)))
+		}
+
+		fk.delete = func(ctx context.Context, c *Clients, id string) error {
+			return f.call(fmt.Sprintf("delete %v %v", name, id))
+		}
+
+		if k.update != nil {
+			fk.update = func(ctx context.Context, c *Clients, id string, spec proto.Message) error {
+				return f.call(fmt.Sprintf("update %v %v", name, id))
+			}
+		}
+
+		kinds[name] = &fk
+	}
+}
+
+func (f *fakeApi) add(kind string, spec proto.Message) {
+	f.nextId++
+	if f.objs == nil {
+		f.objs = map[string][]*Object{}
+	}
+
+	f.objs[kind] = append(f.objs[kind], &Object{Kind: kind, Id: fmt.Sprint(f.nextId), Spec: spec})
+}
+
+func channel(name, typ string) *admin.CreateNotificationChannelRequest {
+	return &admin.CreateNotificationChannelRequest{Name: name, Type: typ}
+}
+
+// summary returns changes as "op kind id->title" strings.
+func summary(changes []*Change) []string {
+	var s []string
+	for _, ch := range changes {
+		var id string
+		if ch.From != nil {
+			id = ch.From.Id
+		}
+
+		s = append(s, fmt.Sprintf("%v %v %v->%v", ch.Op, ch.Kind, id, ch.Title()))
+	}
+
+	return s
+}
+
+func TestPlan(t *testing.T) {
+	f := &fakeApi{}
+	useFake(t, f)
+	f.add(KindNotificationChannel, channel("same", "email"))    // 1
+	f.add(KindNotificationChannel, channel("changed", "email")) // 2
+	f.add(KindNotificationChannel, channel("extra", "email"))   // 3
+	f.add(KindIdentityProvider, &iam.CreateIdentityProviderRequest{Name: "idp", Metadata: "old"})
+	f.add(KindIpFilter, &iam.CreateIpFilterRequest{Type: "whitelist", Value: "10.0.0.1"})
+	f.add(KindCostModifier, &cost.CalculatorCostModifierAwsOptions{AccountId: "1"})
+	desired := []*Object{
+		{Kind: KindNotificationChannel, Spec: channel("same", "email")},
+		{Kind: KindNotificationChannel, Spec: channel("changed", "slack")},
+		{Kind: KindNotificationChannel, Spec: channel("new", "email")},
+		{Kind: KindIdentityProvider, Spec: &iam.CreateIdentityProviderRequest{Name: "idp", Type: "saml", Metadata: "new "}},
+		{Kind: KindIpFilter, Spec: &iam.CreateIpFilterRequest{Value: "10.0.0.2"}},
+	}
+
+	for _, o := range desired {
+		if k := kinds[o.Kind]; k.normalize != nil {
+			k.normalize(o.Spec)
+		}
+	}
+
+	changes, _, err := Plan(context.Background(), &Clients{}, desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"update NotificationChannel 2->changed",
+		"create NotificationChannel ->new",
+		"replace IdentityProvider 4->idp",
+		"create IpFilter ->blacklist 10.0.0.2 (global)",
+	}
+
+	if got := summary(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// desired is not modified.
+	for _, o := range desired {
+		if o.Id != "" {
+			t.Errorf("desired %v got id %v", o.Title(), o.Id)
+		}
+	}
+
+	// Only the kinds in desired are listed.
+	if want := []string{KindNotificationChannel, KindIdentityProvider, KindIpFilter}; !reflect.DeepEqual(f.listed, want) {
+		t.Errorf("listed %v, want %v", f.listed, want)
+	}
+
+	// With prune, deletes are last, in reverse kind order.
+	changes, _, err = Plan(context.Background(), &Clients{}, desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = append(want,
+		"delete IpFilter 5->whitelist 10.0.0.1 (global)",
+		"delete NotificationChannel 3->extra",
+	)
+
+	if got := summary(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPlanNoChanges(t *testing.T) {
+	f := &fakeApi{}
+	useFake(t, f)
+	f.add(KindIdentityProvider, &iam.CreateIdentityProviderRequest{Name: "idp", Type: "saml", Metadata: ""})
+	f.add(KindCalculationSchedule, &cost.CreateCalculationsScheduleRequest{ScheduleMacro: "daily", NotificationChannel: "x"})
+
+	// Merged fields (default channel) and write-only fields (metadata not
+	// returned) are not changes, but the latter are reported.
+	idp := &iam.CreateIdentityProviderRequest{Name: "idp", Type: "saml", Metadata: "xml"}
+	desired := []*Object{
+		{Kind: KindIdentityProvider, Spec: idp},
+		{Kind: KindCalculationSchedule, Spec: &cost.CreateCalculationsScheduleRequest{ScheduleMacro: "daily"}},
+	}
+
+	changes, warnings, err := Plan(context.Background(), &Clients{}, desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) > 0 {
+		t.Errorf("got %q, want no changes", summary(changes))
+	}
+
+	want := []string{"IdentityProvider idp: metadata is not returned by the API, changes to it alone are not detected"}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("got warnings %q, want %q", warnings, want)
+	}
+
+	// Other changes still send the desired metadata.
+	idp.Type = "oidc"
+	changes, _, err = Plan(context.Background(), &Clients{}, desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].To.Spec.(*iam.CreateIdentityProviderRequest).Metadata != "xml" {
+		t.Errorf("got %q, want a replace with the desired metadata", summary(changes))
+	}
+
+	if idp.Metadata != "xml" {
+		t.Errorf("desired metadata changed to %q", idp.Metadata)
+	}
+}
+
+func TestPlanDuplicates(t *testing.T) {
+	f := &fakeApi{}
+	useFake(t, f)
+	f.add(KindNotificationChannel, channel("finance", "email")) // 1
+	f.add(KindNotificationChannel, channel("finance", "slack")) // 2
+	f.add(KindNotificationChannel, channel("other", "email"))   // 3
+	f.add(KindNotificationChannel, channel("other", "email"))   // 4
+	desired := []*Object{{Kind: KindNotificationChannel, Spec: channel("finance", "email")}}
+
+	// Without prune, duplicates are left as is.
+	changes, _, err := Plan(context.Background(), &Clients{}, desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) > 0 {
+		t.Errorf("got %q, want no changes", summary(changes))
+	}
+
+	// With prune, duplicates of desired objects are marked as such.
+	changes, _, err = Plan(context.Background(), &Clients{}, desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"delete NotificationChannel 2->finance (duplicate of 1)",
+		"delete NotificationChannel 3->other",
+		"delete NotificationChannel 4->other",
+	}
+
+	if got := summary(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Duplicates in desired are errors.
+	desired = append(desired, &Object{Kind: KindNotificationChannel, Spec: channel("finance", "slack")})
+	if _, _, err := Plan(context.Background(), &Clients{}, desired, false); err == nil {
+		t.Error("expected an error for duplicates in desired")
+	}
+}
+
+func TestApply(t *testing.T) {
+	idp := func(md string) *Object {
+		return &Object{Kind: KindIdentityProvider, Id: "old", Spec: &iam.CreateIdentityProviderRequest{Name: "idp", Metadata: md}}
+	}
+
+	sched := func(macro string) *Object {
+		return &Object{Kind: KindCalculationSchedule, Id: "old", Spec: &cost.CreateCalculationsScheduleRequest{ScheduleMacro: macro}}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		ch    *Change
+		fail  string
+		calls []string
+		err   string
+	}{
+		{
+			name:  "replace",
+			ch:    &Change{Op: OpReplace, Kind: KindIdentityProvider, From: idp("a"), To: idp("b")},
+			calls: []string{"create IdentityProvider idp", "delete IdentityProvider old"},
+		},
+		{
+			// The current object is kept.
+			name:  "replace create fails",
+			ch:    &Change{Op: OpReplace, Kind: KindIdentityProvider, From: idp("a"), To: idp("b")},
+			fail:  "create",
+			calls: []string{"create IdentityProvider idp"},
+			err:   "replace IdentityProvider idp: failed",
+		},
+		{
+			name:  "replace delete fails",
+			ch:    &Change{Op: OpReplace, Kind: KindIdentityProvider, From: idp("a"), To: idp("b")},
+			fail:  "delete",
+			calls: []string{"create IdentityProvider idp", "delete IdentityProvider old"},
+			err:   "replace IdentityProvider idp: created, but delete of old failed: failed",
+		},
+		{
+			name:  "replace exclusive",
+			ch:    &Change{Op: OpReplace, Kind: KindCalculationSchedule, From: sched("daily"), To: sched("weekly")},
+			calls: []string{"delete CalculationSchedule old", "create CalculationSchedule default"},
+		},
+		{
+			name:  "replace exclusive create fails",
+			ch:    &Change{Op: OpReplace, Kind: KindCalculationSchedule, From: sched("daily"), To: sched("weekly")},
+			fail:  "create",
+			calls: []string{"delete CalculationSchedule old", "create CalculationSchedule default"},
+			err:   "replace CalculationSchedule weekly: deleted old, but create failed: failed",
+		},
+		{
+			name:  "update",
+			ch:    &Change{Op: OpUpdate, Kind: KindNotificationChannel, From: &Object{Kind: KindNotificationChannel, Id: "1", Spec: channel("x", "a")}, To: &Object{Kind: KindNotificationChannel, Spec: channel("x", "b")}},
+			calls: []string{"update NotificationChannel 1"},
+		},
+		{
+			name:  "delete",
+			ch:    &Change{Op: OpDelete, Kind: KindNotificationChannel, From: &Object{Kind: KindNotificationChannel, Id: "1", Spec: channel("x", "a")}},
+			fail:  "delete",
+			calls: []string{"delete NotificationChannel 1"},
+			err:   "delete NotificationChannel x: failed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeApi{fail: tc.fail}
+			useFake(t, f)
+			err := Apply(context.Background(), &Clients{}, tc.ch)
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+
+			if got != tc.err {
+				t.Errorf("got error %q, want %q", got, tc.err)
+			}
+
+			if !reflect.DeepEqual(f.calls, tc.calls) {
+				t.Errorf("got calls %q, want %q", f.calls, tc.calls)
+			}
+		})
+	}
+}
@@ -2,12 +2,19 @@ package ops
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	protosinternal "github.com/alphauslabs/blue-internal-go/protos"
 	"github.com/alphauslabs/blue-sdk-go/operations/v1"
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
 	"github.com/alphauslabs/bluectl/pkg/grpcconn"
+	"github.com/alphauslabs/bluectl/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
@@ -24,7 +31,6 @@ func WaitForOperation(ctx context.Context, in WaitForOperationInput) (*protosint
 	var local bool
 	client := in.Client
 	if client == nil {
-		ctx := context.Background()
 		mycon, err := grpcconn.GetConnection(ctx, grpcconn.OpsService)
 		if err != nil {
 			return nil, err
@@ -51,16 +57,26 @@ func WaitForOperation(ctx context.Context, in WaitForOperationInput) (*protosint
 
 	go func() {
 		for {
-			resp, err := client.WaitOperation(ctx, &operations.WaitOperationRequest{
+			pctx, span := telemetry.Tracer().Start(ctx, "WaitForOperation",
+				trace.WithAttributes(attribute.String("bluectl.operation", in.Name)),
+			)
+
+			resp, err := client.WaitOperation(pctx, &operations.WaitOperationRequest{
 				Name:    in.Name,
 				Timeout: durationpb.New(time.Minute * 4),
 			})
 
 			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.End()
 				done <- &data{err: err}
 				return
 			}
 
+			span.SetAttributes(attribute.Bool("bluectl.operation.done", resp.Done))
+			span.End()
+
 			if resp.Done {
 				done <- &data{op: resp}
 				return
@@ -79,3 +95,27 @@ func WaitForOperation(ctx context.Context, in WaitForOperationInput) (*protosint
 		return nil, nil
 	}
 }
+
+// Wait waits for the operation name to finish, logging progress. It returns
+// cmderr.ErrInterrupted when ctx is canceled (i.e. by SIGINT/SIGTERM).
+func Wait(ctx context.Context, name string) error {
+	defer func(begin time.Time) {
+		logger.Info("duration:", time.Since(begin))
+	}(time.Now())
+
+	logger.Infof("wait for [%v], this could take some time...", name)
+	for {
+		op, err := WaitForOperation(ctx, WaitForOperationInput{Name: name})
+		switch {
+		case err != nil:
+			return err
+		case errors.Is(ctx.Err(), context.Canceled):
+			return cmderr.ErrInterrupted
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case op != nil && op.Done:
+			logger.Infof("[%v] done", name)
+			return nil
+		}
+	}
+}
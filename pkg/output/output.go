@@ -0,0 +1,490 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/alphauslabs/blue-sdk-go/pkg/logger"
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/olekukonko/tablewriter"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FormatTable = "table"
+	FormatCsv   = "csv"
+	FormatJson  = "json"
+	FormatJsonl = "jsonl"
+	FormatYaml  = "yaml"
+)
+
+var (
+	mtx     sync.Mutex
+	created []string // --out files created by this process
+)
+
+// Formats is the list of supported values for --outfmt.
+var Formats = []string{
+	FormatTable,
+	FormatCsv,
+	FormatJson,
+	FormatJsonl,
+	FormatYaml,
+}
+
+// Format returns the effective output format. If --outfmt is not set, it
+// defaults to table when printing to the console, csv when writing to --out.
+func Format() string {
+	f := strings.ToLower(params.OutFmt)
+	if f == "" {
+		if params.OutFile != "" {
+			return FormatCsv
+		}
+
+		return FormatTable
+	}
+
+	return f
+}
+
+// IsStructured returns true if the effective output format is json, jsonl, or yaml.
+func IsStructured() bool {
+	switch Format() {
+	case FormatJson, FormatJsonl, FormatYaml:
+		return true
+	default:
+		return false
+	}
+}
+
+type Input struct {
+	// The column titles used for table outputs. If empty, titles are derived
+	// from Keys (i.e. billingGroupId -> BILLING_GROUP_ID).
+	Headers []string
+
+	// The keys used for csv headers and json/yaml objects; csv, json, jsonl,
+	// and yaml always use keys, table always uses headers. If empty, keys are
+	// derived from Headers (i.e. BILLING_GROUP_ID -> billingGroupId).
+	Keys []string
+
+	// Optional. Per-column alignment (tablewriter.ALIGN_*), table only.
+	Align []int
+
+	// Optional. Max column width, table only. Default is 100.
+	ColWidth int
+
+	// Optional. If true, disable cell text wrapping, table only.
+	NoWrap bool
+
+	// Optional. If true, print received rows while streaming, table only.
+	Progress bool
+
+	// Optional. If true, the command outputs a single item; json and yaml
+	// outputs will be an object instead of a list.
+	Single bool
+}
+
+// Writer renders rows in the format set by --outfmt to stdout, or to the
+// file set by --out.
+type Writer struct {
+	in     Input
+	format string
+	keys   []string
+	out    *errWriter
+	file   *os.File
+	table  *tablewriter.Table
+	csv    *csv.Writer
+	last   any
+	count  int
+	closed bool
+}
+
+// New returns a Writer based on the global --out and --outfmt flags.
+func New(in Input) (*Writer, error) {
+	w := &Writer{
+		in:     in,
+		format: Format(),
+		keys:   in.Keys,
+		out:    &errWriter{w: os.Stdout},
+	}
+
+	switch w.format {
+	case FormatTable, FormatCsv, FormatJson, FormatJsonl, FormatYaml:
+	default:
+		return nil, fmt.Errorf("unsupported output format: %v, valid values: %v",
+			w.format, strings.Join(Formats, ", "))
+	}
+
+	switch {
+	case len(in.Headers) == 0 && len(in.Keys) == 0:
+		return nil, fmt.Errorf("output: headers or keys required")
+	case len(in.Headers) == 0:
+		for _, k := range in.Keys {
+			w.in.Headers = append(w.in.Headers, Title(k))
+		}
+	case len(in.Keys) == 0:
+		for _, h := range in.Headers {
+			w.keys = append(w.keys, Key(h))
+		}
+	}
+
+	if params.OutFile != "" {
+		f, err := os.Create(params.OutFile)
+		if err != nil {
+			return nil, err
+		}
+
+		mtx.Lock()
+		created = append(created, params.OutFile)
+		mtx.Unlock()
+		w.file = f
+		w.out = &errWriter{w: f}
+	}
+
+	switch w.format {
+	case FormatTable:
+		colWidth := 100
+		if in.ColWidth > 0 {
+			colWidth = in.ColWidth
+		}
+
+		w.table = tablewriter.NewWriter(w.out)
+		w.table.SetAutoFormatHeaders(false)
+		w.table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		w.table.SetAlignment(tablewriter.ALIGN_LEFT)
+		if len(in.Align) > 0 {
+			w.table.SetColumnAlignment(in.Align)
+		}
+
+		w.table.SetColWidth(colWidth)
+		w.table.SetAutoWrapText(!in.NoWrap)
+		w.table.SetBorder(false)
+		w.table.SetHeaderLine(false)
+		w.table.SetColumnSeparator("")
+		w.table.SetTablePadding("  ")
+		w.table.SetNoWhiteSpace(true)
+		w.table.SetHeader(w.in.Headers)
+	case FormatCsv:
+		w.csv = csv.NewWriter(w.out)
+		w.csv.Write(w.keys)
+	}
+
+	return w, nil
+}
+
+// Append adds a row to the output. The optional v is the source item of the
+// row; if provided, json, jsonl, and yaml outputs will marshal v instead of
+// the row. Consecutive rows that share the same v are written only once.
+func (w *Writer) Append(row []string, v ...any) error {
+	var item any
+	if len(v) > 0 && v[0] != nil {
+		item = v[0]
+	}
+
+	switch w.format {
+	case FormatTable:
+		if w.in.Progress && w.file == nil {
+			fmt.Printf("\033[2K\rrecv:%v...", row)
+		}
+
+		w.table.Append(row)
+		return nil
+	case FormatCsv:
+		return w.csv.Write(row)
+	}
+
+	if item != nil && w.same(item) {
+		return nil
+	}
+
+	w.last = item
+	var b []byte
+	var err error
+	switch {
+	case item != nil:
+		b, err = Marshal(item)
+	default:
+		b, err = w.object(row)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { w.count++ }()
+
+	switch w.format {
+	case FormatJsonl:
+		_, err = fmt.Fprintf(w.out, "%s\n", b)
+		return err
+	case FormatJson:
+		var ind bytes.Buffer
+		switch {
+		case w.in.Single:
+			json.Indent(&ind, b, "", "  ")
+		default:
+			json.Indent(&ind, b, "  ", "  ")
+			switch w.count {
+			case 0:
+				fmt.Fprint(w.out, "[\n  ")
+			default:
+				fmt.Fprint(w.out, ",\n  ")
+			}
+		}
+
+		_, err = w.out.Write(ind.Bytes())
+		return err
+	default: // yaml
+		var ms yaml.MapSlice
+		err = yaml.Unmarshal(b, &ms)
+		if err != nil {
+			return err
+		}
+
+		var y []byte
+		switch {
+		case w.in.Single:
+			y, err = yaml.Marshal(ms)
+		default:
+			y, err = yaml.Marshal([]yaml.MapSlice{ms})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = w.out.Write(y)
+		return err
+	}
+}
+
+// Footer adds a summary row (e.g. totals), table only.
+func (w *Writer) Footer(row []string) error {
+	if w.format == FormatTable {
+		w.table.Append(row)
+	}
+
+	return nil
+}
+
+// Close flushes all pending output and closes the --out file, if any.
+// Only the first call has effect, so commands can defer Close for early
+// returns, and return the result of Close on success:
+//
+//	defer w.Close()
+//	...
+//	return w.Close()
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	var err error
+	switch w.format {
+	case FormatTable:
+		if w.in.Progress && w.file == nil {
+			fmt.Printf("\033[2K\r") // reset cursor
+		}
+
+		w.table.Render()
+		err = w.out.err
+	case FormatCsv:
+		w.csv.Flush()
+		err = w.csv.Error()
+	case FormatJson:
+		switch {
+		case w.in.Single && w.count == 0:
+			fmt.Fprint(w.out, "{}\n")
+		case w.in.Single:
+			fmt.Fprint(w.out, "\n")
+		case w.count == 0:
+			fmt.Fprint(w.out, "[]\n")
+		default:
+			fmt.Fprint(w.out, "\n]\n")
+		}
+
+		err = w.out.err
+	case FormatYaml:
+		if !w.in.Single && w.count == 0 {
+			fmt.Fprint(w.out, "[]\n")
+		}
+
+		err = w.out.err
+	}
+
+	if w.file != nil {
+		if e := w.file.Close(); e != nil && err == nil {
+			err = e
+		}
+
+		if err == nil {
+			logger.Infof("data written to %v in %v format", params.OutFile, w.format)
+		}
+	}
+
+	return err
+}
+
+// RemovePartial removes the --out files created so far. Used when a command
+// fails or is interrupted, i.e. --rm-partial.
+func RemovePartial() {
+	mtx.Lock()
+	defer mtx.Unlock()
+	for _, f := range created {
+		if err := os.Remove(f); err == nil {
+			logger.Infof("removed partial output %v", f)
+		}
+	}
+
+	created = nil
+}
+
+// Print is a helper for commands that output a single item.
+func Print(in Input, row []string, v ...any) error {
+	in.Single = true
+	w, err := New(in)
+	if err != nil {
+		return err
+	}
+
+	err = w.Append(row, v...)
+	if e := w.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// Marshal returns the compact JSON encoding of v. Protobuf messages are
+// encoded using protojson to match the API's JSON format (camelCase field
+// names, enum names, expanded Any and Struct values), including fields with
+// default values so the output keys are stable.
+func Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return json.Marshal(v)
+	}
+
+	opts := protojson.MarshalOptions{EmitUnpopulated: true}
+	b, err := opts.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// protojson output is intentionally unstable in whitespace.
+	var c bytes.Buffer
+	err = json.Compact(&c, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Bytes(), nil
+}
+
+// Key converts a column title to its json/yaml key, i.e. BILLING_GROUP_ID
+// becomes billingGroupId. Titles that are not all uppercase are returned as is.
+func Key(h string) string {
+	if strings.ToUpper(h) != h {
+		return h
+	}
+
+	var k strings.Builder
+	for i, s := range strings.Split(strings.ToLower(h), "_") {
+		switch {
+		case i == 0 || s == "":
+			k.WriteString(s)
+		default:
+			k.WriteString(strings.ToUpper(s[:1]) + s[1:])
+		}
+	}
+
+	return k.String()
+}
+
+// Title converts a json/yaml key to its column title, i.e. billingGroupId
+// becomes BILLING_GROUP_ID.
+func Title(k string) string {
+	var t strings.Builder
+	for i, r := range k {
+		if i > 0 && unicode.IsUpper(r) {
+			t.WriteRune('_')
+		}
+
+		t.WriteRune(unicode.ToUpper(r))
+	}
+
+	return t.String()
+}
+
+// object returns the JSON object of row using our keys, in column order.
+func (w *Writer) object(row []string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, k := range w.keys {
+		if i >= len(row) {
+			break
+		}
+
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		kb, _ := json.Marshal(k)
+		vb, err := json.Marshal(row[i])
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(kb)
+		b.WriteString(":")
+		b.Write(vb)
+	}
+
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// errWriter keeps the first write error, as some of our writers don't
+// return them (i.e. tablewriter).
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+
+	return n, err
+}
+
+// same checks if v is the same item (pointer) as the previous row's.
+func (w *Writer) same(v any) bool {
+	if w.last == nil {
+		return false
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer {
+		return false
+	}
+
+	return w.last == v
+}
@@ -0,0 +1,258 @@
+package output
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alphauslabs/blue-sdk-go/billing/v1"
+	"github.com/alphauslabs/bluectl/params"
+)
+
+// render writes rows (and footer, if any) in format to a temporary --out
+// file, and returns its contents.
+func render(t *testing.T, format string, in Input, rows [][]string, items []any, footer []string) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "out")
+	params.OutFile, params.OutFmt = out, format
+	t.Cleanup(func() { params.OutFile, params.OutFmt = "", "" })
+	w, err := New(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, row := range rows {
+		var v []any
+		if i < len(items) {
+			v = append(v, items[i])
+		}
+
+		if err := w.Append(row, v...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if footer != nil {
+		if err := w.Footer(footer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestWriter(t *testing.T) {
+	in := Input{Headers: []string{"BILLING_GROUP_ID", "COST"}}
+	rows := [][]string{{"g1", "1.5"}, {"g2", "2"}}
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{
+			// csv headers are keys, not titles
+			format: FormatCsv,
+			want:   "billingGroupId,cost\ng1,1.5\ng2,2\n",
+		},
+		{
+			format: FormatJsonl,
+			want:   `{"billingGroupId":"g1","cost":"1.5"}` + "\n" + `{"billingGroupId":"g2","cost":"2"}` + "\n",
+		},
+		{
+			format: FormatJson,
+			want: `[
+  {
+    "billingGroupId": "g1",
+    "cost": "1.5"
+  },
+  {
+    "billingGroupId": "g2",
+    "cost": "2"
+  }
+]
+`,
+		},
+		{
+			format: FormatYaml,
+			want:   "- billingGroupId: g1\n  cost: \"1.5\"\n- billingGroupId: g2\n  cost: \"2\"\n",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			got := render(t, tc.format, in, rows, nil, []string{"TOTAL", "3.5"})
+			if got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriterTable(t *testing.T) {
+	in := Input{Keys: []string{"billingGroupId", "cost"}}
+	got := render(t, FormatTable, in, [][]string{{"g1", "1.5"}, {"g2", "2"}}, nil, []string{"TOTAL", "3.5"})
+	var fields [][]string
+	for _, l := range strings.Split(strings.TrimSpace(got), "\n") {
+		fields = append(fields, strings.Fields(l))
+	}
+
+	want := [][]string{
+		{"BILLING_GROUP_ID", "COST"},
+		{"g1", "1.5"},
+		{"g2", "2"},
+		{"TOTAL", "3.5"},
+	}
+
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got:\n%s\nwant fields: %v", got, want)
+	}
+}
+
+func TestWriterItems(t *testing.T) {
+	in := Input{Keys: []string{"billingGroupId", "account"}}
+	v1 := &billing.UsageCostsDrift{BillingGroupId: "g1", Account: "a1", Diff: 1.5}
+	v2 := &billing.UsageCostsDrift{BillingGroupId: "g1", Account: "a2"}
+	rows := [][]string{{"g1", "a1"}, {"g1", "a1"}, {"g1", "a2"}}
+
+	// Consecutive rows of the same item are written once.
+	got := render(t, FormatJsonl, in, rows, []any{v1, v1, v2}, nil)
+	want := `{"billingInternalId":"","billingGroupId":"g1","account":"a1","snapshot":0,"current":0,"diff":1.5}` + "\n" +
+		`{"billingInternalId":"","billingGroupId":"g1","account":"a2","snapshot":0,"current":0,"diff":0}` + "\n"
+
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Other formats use the rows.
+	got = render(t, FormatCsv, in, rows, []any{v1, v1, v2}, nil)
+	want = "billingGroupId,account\ng1,a1\ng1,a1\ng1,a2\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		single bool
+		want   string
+	}{
+		{format: FormatJson, want: "[]\n"},
+		{format: FormatJson, single: true, want: "{}\n"},
+		{format: FormatYaml, want: "[]\n"},
+		{format: FormatJsonl, want: ""},
+		{format: FormatCsv, want: "id\n"},
+	} {
+		got := render(t, tc.format, Input{Keys: []string{"id"}, Single: tc.single}, nil, nil, nil)
+		if got != tc.want {
+			t.Errorf("%v (single=%v): got %q, want %q", tc.format, tc.single, got, tc.want)
+		}
+	}
+}
+
+func TestWriterSingle(t *testing.T) {
+	in := Input{Keys: []string{"id"}, Single: true}
+	got := render(t, FormatJson, in, [][]string{{"x"}}, nil, nil)
+	if want := "{\n  \"id\": \"x\"\n}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = render(t, FormatYaml, in, [][]string{{"x"}}, nil, nil)
+	if want := "id: x\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	params.OutFmt = "xml"
+	defer func() { params.OutFmt = "" }()
+	if _, err := New(Input{Keys: []string{"id"}}); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+
+	params.OutFmt = FormatJson
+	if _, err := New(Input{}); err == nil {
+		t.Error("expected an error without headers or keys")
+	}
+}
+
+type failWriter struct{ n int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	w.n++
+	return 0, errors.New("disk full")
+}
+
+func TestErrWriter(t *testing.T) {
+	fw := &failWriter{}
+	w := &Writer{
+		in:     Input{Keys: []string{"id"}},
+		format: FormatJsonl,
+		keys:   []string{"id"},
+		out:    &errWriter{w: fw},
+	}
+
+	if err := w.Append([]string{"a"}); err == nil {
+		t.Error("Append: expected an error")
+	}
+
+	w.Append([]string{"b"})
+	if fw.n != 1 {
+		t.Errorf("got %v writes after an error, want 1", fw.n)
+	}
+
+	w.format = FormatJson
+	if err := w.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("Close: got %v, want the write error", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	defer func() { params.OutFile, params.OutFmt = "", "" }()
+	for _, tc := range []struct {
+		outfmt, out string
+		want        string
+	}{
+		{want: FormatTable},
+		{out: "x.csv", want: FormatCsv},
+		{outfmt: "JSON", out: "x.json", want: FormatJson},
+	} {
+		params.OutFmt, params.OutFile = tc.outfmt, tc.out
+		if got := Format(); got != tc.want {
+			t.Errorf("Format(outfmt=%q, out=%q) = %v, want %v", tc.outfmt, tc.out, got, tc.want)
+		}
+	}
+}
+
+func TestKeyTitle(t *testing.T) {
+	for _, tc := range []struct{ title, key string }{
+		{"BILLING_GROUP_ID", "billingGroupId"},
+		{"ID", "id"},
+		{"COST", "cost"},
+	} {
+		if got := Key(tc.title); got != tc.key {
+			t.Errorf("Key(%v) = %v, want %v", tc.title, got, tc.key)
+		}
+
+		if got := Title(tc.key); got != tc.title {
+			t.Errorf("Title(%v) = %v, want %v", tc.key, got, tc.title)
+		}
+	}
+
+	if got := Key("billingGroupId"); got != "billingGroupId" {
+		t.Errorf("Key of a key: got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Package plugin supports kubectl-style plugins: any executable named
+// bluectl-<name> on PATH can be run as 'bluectl <name>', with our resolved
+// profile settings passed as environment variables.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/env"
+	"github.com/alphauslabs/bluectl/pkg/output"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Prefix is the file name prefix of plugin executables.
+const Prefix = "bluectl-"
+
+// ErrExit is returned (with the plugin's exit code) when a plugin fails. The
+// plugin is expected to have reported its own error.
+var ErrExit = errors.New("plugin failed")
+
+// Plugin is a plugin executable found on PATH.
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Find returns the path of the plugin executable for name.
+func Find(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid plugin name: %q", name)
+	}
+
+	return exec.LookPath(Prefix + name)
+}
+
+// List returns all plugins on PATH, in PATH order. The same name can appear
+// more than once; only the first one is run.
+func List() []Plugin {
+	var plugins []Plugin
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" || seen[dir] {
+			continue
+		}
+
+		seen[dir] = true
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, f := range files {
+			if !strings.HasPrefix(f.Name(), Prefix) {
+				continue
+			}
+
+			path := filepath.Join(dir, f.Name())
+			if !executable(path) {
+				continue
+			}
+
+			name := strings.TrimPrefix(f.Name(), Prefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+
+			if name != "" {
+				plugins = append(plugins, Plugin{Name: name, Path: path})
+			}
+		}
+	}
+
+	return plugins
+}
+
+func executable(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".bat", ".cmd":
+			return true
+		default:
+			return false
+		}
+	}
+
+	return fi.Mode().Perm()&0111 != 0
+}
+
+// Env returns the environment variables that describe our resolved settings
+// (profile, credentials, environment, output), for plugins. Plugins that call
+// bluectl themselves inherit the same settings through $ALPHAUS_PROFILE and
+// the $ALPHAUS_* defaults of our flags.
+func Env(ctx context.Context) ([]string, error) {
+	e, err := env.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	var vars []string
+	add := func(k, v string) {
+		if v != "" {
+			vars = append(vars, k+"="+v)
+		}
+	}
+
+	if self, err := os.Executable(); err == nil {
+		add("BLUECTL", self)
+	}
+
+	add("ALPHAUS_PROFILE", params.AuthProfile)
+	add("ALPHAUS_ENV", e.Name)
+	add("ALPHAUS_AUTH_URL", e.LoginUrl)
+	add("ALPHAUS_ENDPOINT", e.GrpcTarget)
+	add("ALPHAUS_REST_URL", e.RestBase)
+	// Plugins might not call bluectl, so they get the secret of a
+	// credential-process too.
+	id, secret := params.ClientId, params.ClientSecret
+	if params.CredProcess != "" {
+		src, err := auth.Default()
+		if err != nil {
+			return nil, err
+		}
+
+		id, secret, err = src.Credentials()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	add("ALPHAUS_CLIENT_ID", id)
+	add("ALPHAUS_CLIENT_SECRET", secret)
+	add("ALPHAUS_OUTFMT", output.Format())
+	add("ALPHAUS_OUT", params.OutFile)
+	add("ALPHAUS_BARE", fmt.Sprintf("%v", params.CleanOut))
+	add("ALPHAUS_PLAINTEXT", fmt.Sprintf("%v", params.Plaintext))
+	add("ALPHAUS_INSECURE", fmt.Sprintf("%v", params.Insecure))
+	add("ALPHAUS_CA_CERT", params.CaCert)
+
+	// So plugin spans are part of our trace, if --otel-* is set.
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	add("TRACEPARENT", carrier.Get("traceparent"))
+	add("TRACESTATE", carrier.Get("tracestate"))
+	return vars, nil
+}
+
+// Run runs the plugin at path with args, and our settings in its environment.
+// A plugin's non-zero exit status is returned as a cmderr.Error with the same
+// exit code, wrapping ErrExit.
+func Run(ctx context.Context, path string, args []string) error {
+	vars, err := Env(ctx)
+	if err != nil {
+		return err
+	}
+
+	c := exec.CommandContext(ctx, path, args...)
+	c.Cancel = func() error { return c.Process.Signal(os.Interrupt) }
+	c.WaitDelay = 5 * time.Second
+	c.Env = append(os.Environ(), vars...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err = c.Run()
+	var ee *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.As(err, &ee) && ee.ExitCode() > 0:
+		return cmderr.WithCode(ee.ExitCode(), ErrExit)
+	default:
+		return err
+	}
+}
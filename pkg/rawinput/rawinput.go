@@ -0,0 +1,128 @@
+package rawinput
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// Annotation is the cobra command annotation that holds the full name of the
+// request message accepted by --raw-input, for 'bluectl schema'.
+const Annotation = "bluectl/raw-input"
+
+// Flag adds the --raw-input flag to cmd, for request messages of type m.
+// docs is the link to the method in the API reference.
+func Flag(cmd *cobra.Command, p *string, m proto.Message, docs string) {
+	cmd.Flags().StringVar(p, "raw-input", *p, "raw JSON or YAML input, @file, or - for stdin; see "+docs)
+	cmd.Flags().StringArrayVar(&params.RawInputVars, "var", nil, "key=value: template variable for --raw-input, i.e. {{.key}}, repeatable; the input is a template only if set, where {{\"{{\"}} is a literal {{")
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+
+	cmd.Annotations[Annotation] = string(m.ProtoReflect().Descriptor().FullName())
+}
+
+// Unmarshal parses the --raw-input value in into the request message m.
+// The input uses the same format as the REST API docs (camelCase field names,
+// enum names, expanded Any and Struct values), so request bodies from the docs
+// can be used verbatim. in can be inline JSON or YAML, @file to read from a
+// file (*.yaml and *.yml are YAML, others are detected), or - for stdin.
+// Unknown fields are errors. With --var, the input is a Go template; see
+// Execute.
+func Unmarshal(in string, m proto.Message) error {
+	b, err := Read(in, params.RawInputVars)
+	if err != nil {
+		return cmderr.Usage(fmt.Errorf("invalid --raw-input: %w", err))
+	}
+
+	err = protojson.Unmarshal(b, m)
+	if err != nil {
+		return cmderr.Usage(fmt.Errorf("invalid --raw-input: %w (see 'bluectl schema' for the accepted fields)", err))
+	}
+
+	return nil
+}
+
+// Read returns the --raw-input value in as JSON, after executing it as a
+// template with vars (key=value), if any.
+func Read(in string, vars []string) ([]byte, error) {
+	var b []byte
+	var isYaml bool
+	switch {
+	case in == "-":
+		v, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+
+		b = v
+	case strings.HasPrefix(in, "@"):
+		v, err := os.ReadFile(in[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		b = v
+		switch strings.ToLower(filepath.Ext(in)) {
+		case ".yaml", ".yml":
+			isYaml = true
+		}
+	default:
+		b = []byte(in)
+	}
+
+	b, err := Execute(b, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, but we use a JSON parser if we can to keep
+	// the input as is (i.e. large numbers).
+	t := bytes.TrimSpace(b)
+	if !isYaml && len(t) > 0 && t[0] == '{' {
+		return t, nil
+	}
+
+	var v any
+	err = yaml.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(JsonValue(v))
+}
+
+// JsonValue converts decoded YAML values (map[any]any) to their JSON
+// equivalents, for json.Marshal.
+func JsonValue(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, vv := range t {
+			m[fmt.Sprintf("%v", k)] = JsonValue(vv)
+		}
+
+		return m
+	case []any:
+		for i := range t {
+			t[i] = JsonValue(t[i])
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,178 @@
+package rawinput
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphauslabs/blue-sdk-go/cost/v1"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"google.golang.org/protobuf/proto"
+)
+
+// equalJson compares two JSON documents, ignoring formatting.
+func equalJson(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	yml := filepath.Join(dir, "req.yaml")
+	os.WriteFile(yml, []byte("vendor: aws\nawsOptions:\n  groupByColumns: productCode\n"), 0600)
+	js := filepath.Join(dir, "req.json")
+	os.WriteFile(js, []byte(`{"vendor":"aws"}`), 0600)
+	noext := filepath.Join(dir, "req")
+	os.WriteFile(noext, []byte("vendor: aws\n"), 0600)
+
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{in: `{"vendor":"aws"}`, want: `{"vendor":"aws"}`},
+		{in: `vendor: aws`, want: `{"vendor":"aws"}`},
+		{in: "", want: `{}`},
+		{in: "@" + yml, want: `{"vendor":"aws","awsOptions":{"groupByColumns":"productCode"}}`},
+		{in: "@" + js, want: `{"vendor":"aws"}`},
+		{in: "@" + noext, want: `{"vendor":"aws"}`},
+	} {
+		got, err := Read(tc.in, nil)
+		if err != nil {
+			t.Errorf("Read(%q): %v", tc.in, err)
+			continue
+		}
+
+		equalJson(t, got, tc.want)
+	}
+
+	// JSON input is kept as is, i.e. large numbers.
+	in := `{"n": 12345678901234567890}`
+	if got, _ := Read(in, nil); string(got) != in {
+		t.Errorf("Read(%q) = %s", in, got)
+	}
+
+	if _, err := Read("@"+filepath.Join(dir, "missing.yaml"), nil); err == nil {
+		t.Error("Read of a missing file: expected an error")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		in   string
+		vars []string
+		want string
+		err  bool
+	}{
+		{
+			in:   `{"groupId":"{{.group}}","startTime":"{{.PreviousMonth}}01","endTime":"{{.Today}}"}`,
+			vars: []string{"group=xyz"},
+			want: `{"groupId":"xyz","startTime":"` + month.AddDate(0, -1, 0).Format("200601") + `01","endTime":"` + now.Format("20060102") + `"}`,
+		},
+		{
+			in:   "startTime: \"{{.MonthStart}}\"\nendTime: \"{{.Yesterday}}\"\n",
+			vars: []string{"unused=1"},
+			want: `{"startTime":"` + month.Format("20060102") + `","endTime":"` + now.AddDate(0, 0, -1).Format("20060102") + `"}`,
+		},
+		{
+			// --var overrides built-in variables, and values can contain '='
+			in:   `{"a":"{{.Today}}","b":"{{.x}}"}`,
+			vars: []string{"Today=20260101", "x=k=v"},
+			want: `{"a":"20260101","b":"k=v"}`,
+		},
+		{
+			// without --var, inputs are not templates
+			in:   `{"a":"{{.Today}}","b":"{{.undefined}}"}`,
+			want: `{"a":"{{.Today}}","b":"{{.undefined}}"}`,
+		},
+		{
+			in:   `{"a":"{{"{{"}}.x}}"}`,
+			vars: []string{"x=1"},
+			want: `{"a":"{{.x}}"}`,
+		},
+		{
+			in:   `{"a":"{{.undefined}}"}`,
+			vars: []string{"x=1"},
+			err:  true,
+		},
+		{
+			in:   `{"a":"b"}`,
+			vars: []string{"novalue"},
+			err:  true,
+		},
+		{
+			in:   `{"a":"b"}`,
+			vars: []string{"=x"},
+			err:  true,
+		},
+		{
+			in:   `{"a":"{{.x"}`,
+			vars: []string{"x=1"},
+			err:  true,
+		},
+	} {
+		got, err := Read(tc.in, tc.vars)
+		switch {
+		case tc.err && err == nil:
+			t.Errorf("Read(%q, %q): expected an error", tc.in, tc.vars)
+		case !tc.err && err != nil:
+			t.Errorf("Read(%q, %q): %v", tc.in, tc.vars, err)
+		case !tc.err:
+			equalJson(t, got, tc.want)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var in cost.ReadCostsRequest
+	err := Unmarshal("vendor: aws\naccountId: \"123\"\nawsOptions:\n  groupByMonth: true\n", &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &cost.ReadCostsRequest{
+		Vendor:     "aws",
+		AccountId:  "123",
+		AwsOptions: &cost.ReadCostsRequestAwsOptions{GroupByMonth: true},
+	}
+
+	if !proto.Equal(&in, want) {
+		t.Errorf("got %v, want %v", &in, want)
+	}
+
+	for _, raw := range []string{
+		`{"vendor":"aws","unknownField":1}`,
+		"awsOptions:\n  groupByMonths: true\n",
+		`{"vendor":`,
+	} {
+		err := Unmarshal(raw, &cost.ReadCostsRequest{})
+		if err == nil {
+			t.Errorf("Unmarshal(%q): expected an error", raw)
+			continue
+		}
+
+		if cmderr.Code(err) != cmderr.ExitUsage {
+			t.Errorf("Unmarshal(%q): got exit code %v, want %v", raw, cmderr.Code(err), cmderr.ExitUsage)
+		}
+
+		if !strings.Contains(err.Error(), "invalid --raw-input") {
+			t.Errorf("Unmarshal(%q): unexpected error %v", raw, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package rawinput
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Skeleton returns an indented JSON object with all the fields of md, in
+// order, set to zero values (first value for enums). Oneof fields are all
+// included; set only one of each.
+func Skeleton(md protoreflect.MessageDescriptor) []byte {
+	var b bytes.Buffer
+	writeMessage(&b, md, 0, map[protoreflect.FullName]bool{})
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func writeMessage(b *bytes.Buffer, md protoreflect.MessageDescriptor, depth int, seen map[protoreflect.FullName]bool) {
+	if wk, ok := wellKnown(md); ok {
+		b.WriteString(wk)
+		return
+	}
+
+	fields := md.Fields()
+	if fields.Len() == 0 || seen[md.FullName()] {
+		b.WriteString("{}") // also for recursive messages
+		return
+	}
+
+	seen[md.FullName()] = true
+	defer delete(seen, md.FullName())
+	indent := strings.Repeat("  ", depth+1)
+	b.WriteString("{\n")
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		b.WriteString(indent)
+		writeString(b, fd.JSONName())
+		b.WriteString(": ")
+		switch {
+		case fd.IsMap():
+			b.WriteString("{")
+			writeString(b, "")
+			b.WriteString(": ")
+			writeValue(b, fd.MapValue(), depth+1, seen)
+			b.WriteString("}")
+		case fd.IsList():
+			b.WriteString("[")
+			writeValue(b, fd, depth+1, seen)
+			b.WriteString("]")
+		default:
+			writeValue(b, fd, depth+1, seen)
+		}
+
+		if i < fields.Len()-1 {
+			b.WriteByte(',')
+		}
+
+		b.WriteByte('\n')
+	}
+
+	b.WriteString(strings.Repeat("  ", depth) + "}")
+}
+
+func writeValue(b *bytes.Buffer, fd protoreflect.FieldDescriptor, depth int, seen map[protoreflect.FullName]bool) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		writeMessage(b, fd.Message(), depth, seen)
+	case protoreflect.EnumKind:
+		v := fd.Enum().Values()
+		if v.Len() > 0 {
+			writeString(b, string(v.Get(0).Name()))
+		} else {
+			b.WriteString("0")
+		}
+	case protoreflect.BoolKind:
+		b.WriteString("false")
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		writeString(b, "")
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		writeString(b, "0") // same as protojson
+	default:
+		b.WriteString("0")
+	}
+}
+
+// wellKnown returns the JSON skeleton of the well-known types that have a
+// special JSON representation.
+func wellKnown(md protoreflect.MessageDescriptor) (string, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return `"1970-01-01T00:00:00Z"`, true
+	case "google.protobuf.Duration":
+		return `"0s"`, true
+	case "google.protobuf.FieldMask":
+		return `""`, true
+	case "google.protobuf.Struct", "google.protobuf.Empty":
+		return "{}", true
+	case "google.protobuf.ListValue":
+		return "[]", true
+	case "google.protobuf.Value":
+		return "null", true
+	case "google.protobuf.Any":
+		return `{"@type": ""}`, true
+	case "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return `""`, true
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return `"0"`, true
+	case "google.protobuf.BoolValue":
+		return "false", true
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return "0", true
+	}
+
+	return "", false
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	v, _ := json.Marshal(s)
+	b.Write(v)
+}
@@ -0,0 +1,77 @@
+package rawinput
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Vars returns the template variables for vars (key=value), on top of the
+// built-in ones, all in UTC:
+//
+//	CurrentMonth   yyyymm
+//	PreviousMonth  yyyymm
+//	NextMonth      yyyymm
+//	MonthStart     yyyymmdd, first day of the current month
+//	Today          yyyymmdd
+//	Yesterday      yyyymmdd
+//
+// Variables in vars override built-in ones.
+func Vars(vars []string) (map[string]string, error) {
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	m := map[string]string{
+		"CurrentMonth":  month.Format("200601"),
+		"PreviousMonth": month.AddDate(0, -1, 0).Format("200601"),
+		"NextMonth":     month.AddDate(0, 1, 0).Format("200601"),
+		"MonthStart":    month.Format("20060102"),
+		"Today":         now.Format("20060102"),
+		"Yesterday":     now.AddDate(0, 0, -1).Format("20060102"),
+	}
+
+	for _, v := range vars {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid --var %q, expected key=value", v)
+		}
+
+		m[k] = val
+	}
+
+	return m, nil
+}
+
+// Execute runs b as a Go template with Vars(vars) as data, i.e.
+// {"month":"{{.PreviousMonth}}"}, but only if vars is not empty (--var is
+// given), so inputs that happen to contain "{{" are returned as is otherwise.
+// Referencing an undefined variable is an error. In templates, {{"{{"}} is a
+// literal "{{".
+func Execute(b []byte, vars []string) ([]byte, error) {
+	if len(vars) == 0 {
+		return b, nil
+	}
+
+	data, err := Vars(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(b, []byte("{{")) {
+		return b, nil
+	}
+
+	t, err := template.New("raw-input").Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	err = t.Execute(&out, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+// Package rest is a client for the REST API gateway of the current
+// environment, for calls that are simpler over REST (i.e. to get the raw
+// JSON), and for 'bluectl rest' and 'bluectl proxy'.
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/bluectl/pkg/auth"
+	"github.com/alphauslabs/bluectl/pkg/cmderr"
+	"github.com/alphauslabs/bluectl/pkg/env"
+	"github.com/alphauslabs/bluectl/pkg/grpcconn"
+)
+
+// Client sends authenticated requests to the REST API. It's also an
+// http.RoundTripper that adds access tokens, for proxies.
+type Client struct {
+	Base string       // base URL, no trailing slash
+	Http *http.Client // adds access tokens, see RoundTrip
+
+	src  *auth.Source
+	next http.RoundTripper
+}
+
+// New returns a Client for the current environment and profile. A timeout
+// of 0 means no timeout other than the command's --timeout.
+func New(timeout time.Duration) (*Client, error) {
+	e, err := env.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := e.Rest()
+	if err != nil {
+		return nil, cmderr.Usage(err)
+	}
+
+	src, err := auth.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := grpcconn.TlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = cfg
+	c := &Client{Base: base, src: src, next: t}
+	c.Http = &http.Client{Timeout: timeout, Transport: c}
+	return c, nil
+}
+
+// Url returns the full URL of path, which is relative to Base (with or
+// without the leading slash), or an absolute URL under Base.
+func (c *Client) Url(path string) (string, error) {
+	switch {
+	case strings.HasPrefix(path, "https://"), strings.HasPrefix(path, "http://"):
+		if path != c.Base && !strings.HasPrefix(path, c.Base+"/") && !strings.HasPrefix(path, c.Base+"?") {
+			return "", fmt.Errorf("%v is not under %v", path, c.Base)
+		}
+
+		return path, nil
+	case !strings.HasPrefix(path, "/"):
+		path = "/" + path
+	}
+
+	_, err := url.Parse(c.Base + path)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Base + path, nil
+}
+
+// Do sends r with an access token; see RoundTrip.
+func (c *Client) Do(r *http.Request) (*http.Response, error) { return c.Http.Do(r) }
+
+// RoundTrip implements http.RoundTripper. It sends r with an access token,
+// replacing any Authorization header. If the token is rejected, it gets a
+// new one and retries once, if r's body can be sent again. The token is only
+// invalidated if no other request has refreshed it since r was sent.
+func (c *Client) RoundTrip(r *http.Request) (*http.Response, error) {
+	var t string
+	send := func() (*http.Response, error) {
+		var err error
+		t, err = c.src.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		rr := r.Clone(r.Context())
+		rr.Header.Set("Authorization", "Bearer "+t)
+		return c.next.RoundTrip(rr)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	c.src.InvalidateToken(t) // also for the next requests if we can't retry
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.GetBody == nil {
+			return resp, nil
+		}
+
+		body, err := r.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+
+		r = r.Clone(r.Context())
+		r.Body = body
+	}
+
+	resp.Body.Close()
+	return send()
+}
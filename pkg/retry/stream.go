@@ -0,0 +1,212 @@
+// Package retry re-issues server streams that fail with transient errors,
+// resuming from where the previous stream stopped.
+package retry
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"log"
+	"maps"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/bluectl/params"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Backoff between retries; vars for tests.
+var (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// retrylog writes our retry notices to stderr, so they never mix with the
+// command's output, i.e. --outfmt json.
+var retrylog = log.New(os.Stderr, "", log.LstdFlags)
+
+// Receiver is the receiving side of a gRPC server stream, i.e. cost.Cost_ReadCostsClient.
+type Receiver[T proto.Message] interface {
+	Recv() (T, error)
+}
+
+// Stream is a resumable server stream.
+type Stream[T proto.Message] struct {
+	// Open opens the stream. from is empty on the first call; on retries, it
+	// is the date (yyyymmdd) of the last received item if Date is set and
+	// the items so far were ordered by date, empty otherwise.
+	Open func(ctx context.Context, from string) (Receiver[T], error)
+
+	// Optional. Returns the date of an item (i.e. yyyy-mm-dd, yyyymm); used
+	// to re-issue the stream for the remaining date range only. If nil, the
+	// stream is re-issued as is.
+	Date func(T) string
+}
+
+// Transient returns true if err is worth retrying.
+func Transient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Do calls fn for each item of the stream. On transient errors, the stream
+// is re-opened after an exponential backoff, up to --retries consecutive
+// times without progress, and items that were already received are skipped.
+// If Date is set and the items received so far are ordered by date, the
+// stream is re-opened from the date of the last item; otherwise it is
+// re-opened as is, and the items received so far are skipped by count.
+func (s Stream[T]) Do(ctx context.Context, fn func(T) error) error {
+	var n int                // number of items received so far
+	var last string          // yyyymmdd of the last received item
+	ordered := s.Date != nil // whether the items so far are ordered by date
+	var retries int
+	var progress bool
+
+	// Hashes (and counts) of the received items dated last, the ones that
+	// will be sent again if we resume from last.
+	atLast := map[uint64]int{}
+
+	// What the re-opened stream sends again: either the items from date
+	// from, of which the ones in resent were received, or the first skip
+	// items of the full stream.
+	var from string
+	var resent map[uint64]int
+	var skip int
+
+	backoff := minBackoff
+	for {
+		rs, err := s.Open(ctx, from)
+		var i int // items received from this stream
+		for err == nil {
+			var v T
+			v, err = rs.Recv()
+			if err != nil {
+				break
+			}
+
+			i++
+			if i <= skip {
+				continue
+			}
+
+			var d string
+			if s.Date != nil {
+				d = date(s.Date(v))
+			}
+
+			if from != "" {
+				if d < from {
+					continue
+				}
+
+				if d == from && len(resent) > 0 {
+					h := hash(v)
+					if resent[h] > 0 {
+						resent[h]--
+						continue
+					}
+				}
+			}
+
+			if ordered {
+				switch {
+				case d == "" || d < last:
+					ordered = false
+					clear(atLast)
+				case d > last:
+					last = d
+					clear(atLast)
+				}
+
+				if ordered {
+					atLast[hash(v)]++
+				}
+			}
+
+			n++
+			progress = true
+			err = fn(v)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case err == io.EOF:
+			return nil
+		case !Transient(err) || ctx.Err() != nil:
+			return err
+		}
+
+		if progress {
+			retries = 0
+			backoff = minBackoff
+			progress = false
+		}
+
+		retries++
+		if retries > params.Retries {
+			return err
+		}
+
+		if ordered && last != "" {
+			from, skip = last, 0
+			resent = maps.Clone(atLast)
+		} else {
+			from, skip = "", n
+			resent = nil
+		}
+
+		// Add jitter, so parallel runs don't retry in lockstep.
+		wait := time.Duration(rand.Int63n(int64(backoff))) + backoff/2
+		retrylog.Printf("%v, retry %v/%v in %v...", err, retries, params.Retries, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// date returns d (yyyy-mm-dd, yyyymmdd, yyyy-mm, yyyymm) in yyyymmdd
+// format, or empty if d is not a date.
+func date(d string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+
+		return -1
+	}, d)
+
+	switch {
+	case len(digits) >= 8:
+		return digits[:8]
+	case len(digits) == 6:
+		return digits + "01"
+	default:
+		return ""
+	}
+}
+
+// hash returns the hash of the wire encoding of m.
+func hash(m proto.Message) uint64 {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
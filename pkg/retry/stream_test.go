@@ -0,0 +1,195 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphauslabs/bluectl/params"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeRecv sends items, then err (io.EOF if nil).
+type fakeRecv struct {
+	items []string
+	err   error
+}
+
+func (r *fakeRecv) Recv() (*wrapperspb.StringValue, error) {
+	if len(r.items) == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		return nil, io.EOF
+	}
+
+	v := r.items[0]
+	r.items = r.items[1:]
+	return wrapperspb.String(v), nil
+}
+
+// itemDate returns the date of "<account>-<yyyymm>" items.
+func itemDate(v *wrapperspb.StringValue) string {
+	_, d, _ := strings.Cut(v.Value, "-")
+	return d
+}
+
+// filter returns the items dated from and after.
+func filter(items []string, from string) []string {
+	var out []string
+	for _, v := range items {
+		if from == "" || date(itemDate(wrapperspb.String(v))) >= from {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func init() {
+	minBackoff = time.Millisecond
+	maxBackoff = time.Millisecond
+	params.Retries = 3
+}
+
+func TestStreamDo(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	for _, tc := range []struct {
+		name  string
+		items []string
+		fail  []int // stream i fails after fail[i] items
+		dated bool
+		froms []string // expected from of each Open
+	}{
+		{
+			name:  "ordered",
+			items: []string{"a-202409", "b-202409", "a-202410", "b-202410"},
+			dated: true,
+			froms: []string{""},
+		},
+		{
+			// i.e. usage get grouped by account: not ordered by date overall
+			name:  "unordered",
+			items: []string{"a-202409", "a-202410", "b-202409", "b-202410"},
+			dated: true,
+			froms: []string{""},
+		},
+		{
+			name:  "ordered retry",
+			items: []string{"a-202409", "b-202409", "a-202410", "b-202410", "c-202410", "a-202411"},
+			fail:  []int{3, 2},
+			dated: true,
+			froms: []string{"", "20241001", "20241001"},
+		},
+		{
+			name:  "unordered retry",
+			items: []string{"a-202409", "a-202410", "b-202409", "b-202410"},
+			fail:  []int{3},
+			dated: true,
+			froms: []string{"", ""},
+		},
+		{
+			name:  "undated retry",
+			items: []string{"a", "b", "c", "d"},
+			fail:  []int{1, 3},
+			froms: []string{"", "", ""},
+		},
+		{
+			name:  "duplicates",
+			items: []string{"a-202409", "a-202410", "a-202410", "b-202410"},
+			fail:  []int{2},
+			dated: true,
+			froms: []string{"", "20241001"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var froms []string
+			s := Stream[*wrapperspb.StringValue]{
+				Open: func(ctx context.Context, from string) (Receiver[*wrapperspb.StringValue], error) {
+					items := filter(tc.items, from)
+					r := &fakeRecv{items: items}
+					if i := len(froms); i < len(tc.fail) {
+						r.items = items[:tc.fail[i]]
+						r.err = unavailable
+					}
+
+					froms = append(froms, from)
+					return r, nil
+				},
+			}
+
+			if tc.dated {
+				s.Date = itemDate
+			}
+
+			var got []string
+			err := s.Do(context.Background(), func(v *wrapperspb.StringValue) error {
+				got = append(got, v.Value)
+				return nil
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.items) {
+				t.Errorf("got %v, want %v", got, tc.items)
+			}
+
+			if !reflect.DeepEqual(froms, tc.froms) {
+				t.Errorf("opened from %q, want %q", froms, tc.froms)
+			}
+		})
+	}
+}
+
+func TestStreamDoErrors(t *testing.T) {
+	opens := 0
+	s := Stream[*wrapperspb.StringValue]{
+		Open: func(ctx context.Context, from string) (Receiver[*wrapperspb.StringValue], error) {
+			opens++
+			return &fakeRecv{err: status.Error(codes.Unavailable, "unavailable")}, nil
+		},
+	}
+
+	err := s.Do(context.Background(), func(*wrapperspb.StringValue) error { return nil })
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, want Unavailable", err)
+	}
+
+	if opens != params.Retries+1 {
+		t.Errorf("opened %v times, want %v", opens, params.Retries+1)
+	}
+
+	opens = 0
+	s.Open = func(ctx context.Context, from string) (Receiver[*wrapperspb.StringValue], error) {
+		opens++
+		return &fakeRecv{err: status.Error(codes.InvalidArgument, "bad")}, nil
+	}
+
+	err = s.Do(context.Background(), func(*wrapperspb.StringValue) error { return nil })
+	if status.Code(err) != codes.InvalidArgument || opens != 1 {
+		t.Errorf("got %v after %v opens, want InvalidArgument after 1", err, opens)
+	}
+}
+
+func TestDate(t *testing.T) {
+	for in, want := range map[string]string{
+		"2024-09-15": "20240915",
+		"20240915":   "20240915",
+		"2024-09":    "20240901",
+		"202409":     "20240901",
+		"":           "",
+		"abc":        "",
+	} {
+		if got := date(in); got != want {
+			t.Errorf("date(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package telemetry provides optional OpenTelemetry tracing of bluectl
+// invocations: a span per command, with child spans for API calls and
+// operation polls, exported to an OTLP endpoint or a local JSON file.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alphauslabs/bluectl/params"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const name = "github.com/alphauslabs/bluectl"
+
+var (
+	provider *sdktrace.TracerProvider
+	file     *os.File
+)
+
+// Enabled returns true if --otel-endpoint or --otel-file is set.
+func Enabled() bool { return params.OtelEndpoint != "" || params.OtelFile != "" }
+
+// Tracer returns our tracer. Spans are no-op if telemetry is not enabled.
+func Tracer() trace.Tracer { return otel.Tracer(name) }
+
+// StartCommand sets up our tracer provider, then starts the span of cmd as
+// a child of $TRACEPARENT, if set. Call from PersistentPreRun hooks.
+func StartCommand(cmd *cobra.Command) error {
+	if !Enabled() {
+		return nil
+	}
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch {
+	case params.OtelFile != "":
+		file, err = os.OpenFile(params.OtelFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		var opt otlptracegrpc.Option
+		switch {
+		case strings.Contains(params.OtelEndpoint, "://"):
+			opt = otlptracegrpc.WithEndpointURL(params.OtelEndpoint)
+		default:
+			opt = otlptracegrpc.WithEndpoint(params.OtelEndpoint)
+		}
+
+		exp, err = otlptracegrpc.New(cmd.Context(), opt)
+	}
+
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "bluectl"),
+		attribute.String("service.version", params.Version),
+	))
+
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+
+	otel.SetTracerProvider(provider)
+	prop := propagation.TraceContext{}
+	otel.SetTextMapPropagator(prop)
+	ctx := prop.Extract(cmd.Context(), propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	})
+
+	ctx, _ = Tracer().Start(ctx, cmd.CommandPath(),
+		trace.WithAttributes(
+			attribute.String("bluectl.command", cmd.CommandPath()),
+			attribute.String("bluectl.env", params.Env),
+			attribute.String("bluectl.profile", params.AuthProfile),
+		),
+	)
+
+	cmd.SetContext(ctx)
+	return nil
+}
+
+// EndCommand ends the span started by StartCommand, then flushes all spans.
+func EndCommand(ctx context.Context, err error, code int) {
+	if provider == nil {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("bluectl.exit_code", code))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	provider.Shutdown(ctx)
+	if file != nil {
+		file.Close()
+	}
+}